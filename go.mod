@@ -1,6 +1,9 @@
 module github.com/matobi/mam-go-lib
 
+go 1.16
+
 require (
 	github.com/pkg/errors v0.8.0
 	github.com/rs/zerolog v1.8.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,344 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bind Populate the struct pointed to by v from config. Fields are declared with tags like
+//
+//	Port  int      `conf:"port,type=int,required,default=8080,profile=prod"`
+//	Hosts []string `conf:"hosts,default=a|b"`
+//	DB    DBConf   `conf:"db"` // nested struct, keys are prefixed with "db."
+//
+// The first tag value is the key name. Options are:
+// type (see valueTypeNames), values allowed for type enum (separated by |),
+// default used if key is missing (list values separated by |),
+// profile the default applies to, and required. Type is taken from the field type if not given.
+// Fields may also be *url.URL and *regexp.Regexp, and int fields of type bytesize get the size in bytes.
+// Slices are bound to lists. Nested structs without tag are bound without prefix.
+// All errors are added to Errors and the first of them is returned.
+func (c *Config) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		err := fmt.Errorf("bind needs pointer to struct; got=%T", v)
+		c.addErr(err)
+		return err
+	}
+	before := c.errCount()
+	c.Interpolate()
+	c.bindStruct(rv.Elem(), "", false)
+	return c.errAfter(before)
+}
+
+// bindTypes Record types from the tags of v without binding, so e.g. type=secret is redacted
+// when values are logged before Bind. Tag errors are reported by Bind.
+func (c *Config) bindTypes(v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct {
+		c.bindStruct(rv.Elem(), "", true)
+	}
+}
+
+type bindTag struct {
+	name       string
+	t          ValueType
+	hasType    bool
+	required   bool
+	values     []string
+	def        string
+	hasDefault bool
+	profile    string
+	list       bool
+}
+
+// valueTypeNames Names of value types in conf tags and Usage.
+var valueTypeNames = map[string]ValueType{
+	"str":      VtStr,
+	"int":      VtInt,
+	"file":     VtFile,
+	"dir":      VtDir,
+	"list":     VtList,
+	"bool":     VtBool,
+	"float":    VtFloat,
+	"duration": VtDuration,
+	"url":      VtURL,
+	"hostport": VtHostPort,
+	"enum":     VtEnum,
+	"regexp":   VtRegexp,
+	"bytesize": VtByteSize,
+	"secret":   VtSecret,
+}
+
+func parseBindTag(tag string) (bindTag, error) {
+	parts := strings.Split(tag, ",")
+	bt := bindTag{name: strings.TrimSpace(parts[0])}
+	for _, opt := range parts[1:] {
+		opt = strings.TrimSpace(opt)
+		key, value := opt, ""
+		if index := strings.Index(opt, "="); index >= 0 {
+			key, value = opt[:index], opt[index+1:]
+		}
+		switch key {
+		case "type":
+			t, isFound := valueTypeNames[value]
+			if !isFound {
+				return bt, fmt.Errorf("unknown type; type=%s", value)
+			}
+			bt.t = t
+			bt.hasType = true
+		case "required":
+			bt.required = true
+		case "values":
+			bt.values = strings.Split(value, "|")
+		case "default":
+			bt.def = value
+			bt.hasDefault = true
+		case "profile":
+			bt.profile = value
+		default:
+			return bt, fmt.Errorf("unknown tag option; option=%s", opt)
+		}
+	}
+	return bt, nil
+}
+
+// bindStruct Bind fields of rv. With typesOnly only the types of the keys are recorded.
+func (c *Config) bindStruct(rv reflect.Value, prefix string, typesOnly bool) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		tag, hasTag := field.Tag.Lookup("conf")
+		if tag == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			if !hasTag {
+				c.bindStruct(fv, prefix, typesOnly)
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			c.bindStruct(fv, prefix+name+".", typesOnly)
+			continue
+		}
+		if !hasTag {
+			continue
+		}
+		bt, err := parseBindTag(tag)
+		if err != nil {
+			if !typesOnly {
+				c.addErr(fmt.Errorf("bad conf tag; field=%s; %v", field.Name, err))
+			}
+			continue
+		}
+		if bt.name == "" {
+			bt.name = field.Name
+		}
+		bt.name = prefix + bt.name
+		if !bt.hasType {
+			bt.t = inferType(field.Type)
+		}
+		if typesOnly {
+			c.bindType(bt.name, bt.t)
+			continue
+		}
+		if bt.t == VtEnum {
+			c.SetEnum(bt.name, bt.values...)
+		}
+		bt.list = field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() != reflect.Uint8
+		c.mu.Lock()
+		c.bindings[bt.name] = bt
+		c.mu.Unlock()
+		if bt.list {
+			c.bindList(fv, bt)
+		} else {
+			c.bindValue(fv, bt)
+		}
+	}
+}
+
+// addBindDefault Add default of a bound key, or its value from env, if the key is missing.
+// Also called by Reload, so defaults of keys bound after Load are kept.
+func (c *Config) addBindDefault(bt bindTag) {
+	if bt.list {
+		if !c.isList(bt.name) && bt.hasDefault {
+			for _, v := range strings.Split(bt.def, "|") {
+				c.AddListProfile(bt.t, bt.profile, bt.name, v)
+			}
+		}
+		return
+	}
+	if _, isFound := c.lookup(bt.name); isFound {
+		return
+	}
+	// env can supply keys not added by code or files
+	if c.hasEnv(bt.name) {
+		c.AddProfile(bt.t, "", bt.name, "") // value is replaced by envOverride
+	} else if bt.hasDefault {
+		c.AddProfile(bt.t, bt.profile, bt.name, bt.def)
+	}
+}
+
+func (c *Config) bindValue(fv reflect.Value, bt bindTag) {
+	value, isFound := c.Lookup(bt.name)
+	if !isFound {
+		c.addBindDefault(bt)
+		value, isFound = c.Lookup(bt.name)
+	} else if err := c.checkValue(bt.t, bt.name, value); err != nil {
+		c.addErr(err)
+		return
+	} else {
+		c.bindType(bt.name, bt.t)
+	}
+	if !isFound {
+		if bt.required {
+			c.addErr(fmt.Errorf("property required; name=%s", bt.name))
+		}
+		return
+	}
+	if err := setField(fv, bt.t, value); err != nil {
+		c.addErr(c.valueErr("failed bind property", bt.name, value, err))
+	}
+}
+
+// bindType Record type from the tag for a key added by files, consul or env, so e.g. type=secret
+// is redacted in Dump and logs. Bound types are kept by Reload, see typeOf.
+func (c *Config) bindType(name string, t ValueType) {
+	if t == VtStr {
+		return // plain strings do not replace a known type
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bound[name] = t
+}
+
+func (c *Config) bindList(fv reflect.Value, bt bindTag) {
+	c.addBindDefault(bt)
+	if !c.isList(bt.name) {
+		if bt.required {
+			c.addErr(fmt.Errorf("property required; name=%s", bt.name))
+		}
+		return
+	}
+	c.bindType(bt.name, bt.t)
+	list := c.StrList(bt.name)
+	slice := reflect.MakeSlice(fv.Type(), len(list), len(list))
+	for i, v := range list {
+		if err := setField(slice.Index(i), bt.t, v); err != nil {
+			c.addErr(c.valueErr("failed bind property list", bt.name, v, err))
+			return
+		}
+	}
+	fv.Set(slice)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(&url.URL{})
+	regexpType   = reflect.TypeOf(&regexp.Regexp{})
+)
+
+// inferType Returns value type for a field without type option.
+func inferType(t reflect.Type) ValueType {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch t {
+	case durationType:
+		return VtDuration
+	case urlType:
+		return VtURL
+	case regexpType:
+		return VtRegexp
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return VtInt
+	case reflect.Bool:
+		return VtBool
+	case reflect.Float32, reflect.Float64:
+		return VtFloat
+	default:
+		return VtStr
+	}
+}
+
+// setField Parse value of type t into fv according to its type.
+func setField(fv reflect.Value, t ValueType, value string) error {
+	switch fv.Type() {
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case urlType:
+		u, err := parseURL(value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(u))
+		return nil
+	case regexpType:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(re))
+		return nil
+	}
+	if t == VtByteSize {
+		n, err := ParseByteSize(value)
+		if err != nil {
+			return err
+		}
+		value = strconv.FormatInt(n, 10)
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported field type; type=%s", fv.Type())
+		}
+		fv.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("unsupported field type; type=%s", fv.Type())
+	}
+	return nil
+}
@@ -3,8 +3,10 @@ package conf
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 )
@@ -17,38 +19,103 @@ const (
 	VtFile
 	VtDir
 	VtList
+	VtBool
+	VtFloat
+	VtDuration
+	VtURL
+	VtHostPort
+	VtEnum // allowed values are set with SetEnum
+	VtRegexp
+	VtByteSize // e.g. 512, 10KB, 1.5GiB or 64M. See ParseByteSize.
+	VtSecret   // string that is never logged, see Redact
 )
 
+func (t ValueType) String() string {
+	for name, vt := range valueTypeNames {
+		if vt == t {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Config Values, Lists and Errors can be read directly while values are added. Once keys can
+// change, by Reload or WatchConsulKV, read them with the getters, Dump and ErrorList instead:
+// a reload replaces the maps and errors are added under a lock.
 type Config struct {
 	Values  map[string]string
 	Lists   map[string][]string
 	Errors  []error
 	Profile string
+	Redact  []string // values of keys containing any of these (lower case) are not logged
+
+	mu        sync.RWMutex // guards Values, Lists and Errors when keys are reloaded
+	types     map[string]ValueType
+	bound     map[string]ValueType // types from Bind tags, kept by Reload
+	bindings  map[string]bindTag   // tags bound by Bind, their defaults are added again by Reload
+	origins   map[string]Origin
+	chain     []string // active profiles, most specific first
+	enums     map[string][]string
+	required  []string
+	envPrefix string              // see SetEnvPrefix
+	failed    map[string]string   // raw values Interpolate reported errors for
+	missing   map[string]bool     // required keys reported missing
+	flagArgs  []string            // args given to ParseFlags, applied again by Reload
+	rawValues map[string]string   // values with ${} references as added, Values holds them resolved
+	rawLists  map[string][]string // lists with ${} references as added
+
+	readMu sync.Mutex
+	reads  map[string]bool // keys read by getters, see Unused
+
+	loader      Loader
+	files       []string // files to watch for reload
+	reloadMu    sync.Mutex
+	subMu       sync.Mutex
+	subscribers []func(changed []string)
 }
 
 func NewConfig(profile string) *Config {
 	conf := &Config{
-		Values: make(map[string]string),
-		Lists:  make(map[string][]string),
-		Errors: []error{},
+		Values:    make(map[string]string),
+		Lists:     make(map[string][]string),
+		Errors:    []error{},
+		types:     make(map[string]ValueType),
+		bound:     make(map[string]ValueType),
+		bindings:  make(map[string]bindTag),
+		origins:   make(map[string]Origin),
+		enums:     make(map[string][]string),
+		reads:     make(map[string]bool),
+		failed:    make(map[string]string),
+		missing:   make(map[string]bool),
+		rawValues: make(map[string]string),
+		rawLists:  make(map[string][]string),
+		Redact:    append([]string{}, DefaultRedact...),
 	}
 	conf.Values["profile"] = profile
+	conf.origins["profile"] = Origin{Source: SrcDefault}
 	conf.Profile = profile
+	conf.chain = profileChain(profile)
 	return conf
 }
 
 //////// Add functions
 
+// Add Add a default value. See Source for precedence over values from other sources.
 func (c *Config) Add(t ValueType, name, value string) {
 	c.AddProfile(t, "", name, value)
 }
 
 func (c *Config) AddProfile(t ValueType, profile, name, value string) {
-	value, ok := c.validate(t, profile, name, value)
+	c.addValue(t, name, value, Origin{Source: SrcDefault, Profile: profile})
+}
+
+// addValue Add a value from origin. Origin location, e.g. file:line, is included in validation errors.
+func (c *Config) addValue(t ValueType, name, value string, origin Origin) {
+	value, origin, ok := c.validate(t, name, value, origin)
 	if !ok {
 		return
 	}
-	c.Values[name] = value
+	c.store(t, name, value, origin)
 }
 
 func (c *Config) AddList(t ValueType, name, value string) {
@@ -56,38 +123,99 @@ func (c *Config) AddList(t ValueType, name, value string) {
 }
 
 func (c *Config) AddListProfile(t ValueType, profile, name, value string) {
-	value, ok := c.validate(t, profile, name, value)
+	c.addListValue(t, name, value, Origin{Source: SrcDefault, Profile: profile})
+}
+
+// addListValue Append value to list. A list from an origin of higher precedence replaces the current list.
+func (c *Config) addListValue(t ValueType, name, value string, origin Origin) {
+	value, origin, ok := c.validate(t, name, value, origin)
 	if !ok {
 		return
 	}
-	list, isFound := c.Lists[name]
-	if !isFound {
-		list = []string{}
+	c.mu.Lock()
+	current, isFound := c.origins[name]
+	if isFound && c.precedes(current, origin) {
+		c.mu.Unlock()
+		return
 	}
-	list = append(list, value)
-	c.Lists[name] = list
-	log.Info().Str("name", name).Str("value", value).Msg("property list")
+	if !isFound || c.precedes(origin, current) {
+		c.Lists[name] = []string{}
+		delete(c.rawLists, name)
+	}
+	c.Lists[name] = append(c.Lists[name], value)
+	if raw, isFound := c.rawLists[name]; isFound {
+		c.rawLists[name] = append(raw, value)
+	}
+	c.types[name] = t
+	c.origins[name] = origin
+	c.mu.Unlock()
+	log.Info().Str("name", name).Str("value", c.redact(name, value)).Msg("property list")
 }
 
-func (c *Config) validate(t ValueType, profile, name, value string) (string, bool) {
-	if profile != "" && profile != c.Profile {
-		return "", false // inactive profile. Not an error, but skip this value
+// validate Returns value to add, replaced by env if set, and its origin.
+func (c *Config) validate(t ValueType, name, value string, origin Origin) (string, Origin, bool) {
+	if !c.isActive(origin.Profile) {
+		return "", origin, false // inactive profile. Not an error, but skip this value
 	}
 	if name == "" {
-		c.addErr(fmt.Errorf("propery name was nil; value=%s", value))
-		return "", false
+		c.addErr(withSource(fmt.Errorf("propery name was nil; value=%s", value), origin.Location))
+		return "", origin, false
+	}
+	if origin.Source < SrcEnv {
+		envValue, envName, err := c.envOverride(name, value)
+		if err != nil {
+			c.addErr(withSource(err, origin.Location))
+			return "", origin, false
+		}
+		if envName != "" {
+			value, origin = envValue, Origin{Source: SrcEnv, Location: envName}
+		}
+	}
+	if err := c.checkValue(t, name, value); err != nil {
+		c.addErr(withSource(err, origin.Location))
+		return "", origin, false
+	}
+	return value, origin, true
+}
+
+func withSource(err error, source string) error {
+	if source == "" {
+		return err
+	}
+	return fmt.Errorf("%v; source=%s", err, source)
+}
+
+// checkValue Returns error if value is not valid for type t.
+func (c *Config) checkValue(t ValueType, name, value string) error {
+	if strings.Contains(value, "${") {
+		return nil // checked by Interpolate
+	}
+	if t == VtEnum {
+		return c.checkEnum(name, value)
 	}
-	value = c.envOverride(name, value)
 	if !c.isValidType(t, value) {
-		c.addErr(fmt.Errorf("propery value invalid; name=%s; value=%s", name, value))
-		return "", false
+		return c.valueErr("propery value invalid", name, value, nil)
 	}
-	return value, true
+	return nil
+}
+
+// typeOf Returns type a key was bound or added with. VtStr if unknown. A key added as VtSecret stays secret.
+func (c *Config) typeOf(name string) ValueType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, isFound := c.types[name]
+	if bt, isBound := c.bound[name]; isBound && t != VtSecret {
+		return bt
+	}
+	if isFound {
+		return t
+	}
+	return VtStr
 }
 
 func (c *Config) isValidType(t ValueType, value string) bool {
 	switch t {
-	case VtStr:
+	case VtStr, VtSecret:
 		return true
 	case VtInt:
 		_, err := strconv.ParseInt(value, 10, 64)
@@ -98,47 +226,100 @@ func (c *Config) isValidType(t ValueType, value string) bool {
 		return isDir(value)
 	case VtFile:
 		return isFile(value)
+	case VtEnum:
+		return true // checked against allowed values by checkValue
+	case VtBool, VtFloat, VtDuration, VtURL, VtHostPort, VtRegexp, VtByteSize:
+		return parseValue(t, value) == nil
 	default:
 		log.Error().Int("valueType", int(t)).Str("value", value).Msg("property type unknown")
 		return false
 	}
 }
 
-func (c *Config) envOverride(name, value string) string {
-	envValue, ok := os.LookupEnv(name)
-	if !ok {
-		return value
+// envOverride Returns value of env variable for name, see EnvName, if set. Otherwise, if the variable
+// with suffix _FILE is set, content of that file, e.g. a docker or kubernetes secret.
+// envName is the variable used, "" if none.
+func (c *Config) envOverride(name, value string) (string, string, error) {
+	envName := c.EnvName(name)
+	if envValue, ok := os.LookupEnv(envName); ok {
+		return envValue, envName, nil
+	}
+	if path, ok := os.LookupEnv(envName + "_FILE"); ok {
+		envValue, err := readSecretFile(path)
+		return envValue, envName + "_FILE", err
 	}
-	return envValue
+	return value, "", nil
 }
 
+// hasEnv Returns true if envOverride has a value for name.
+func (c *Config) hasEnv(name string) bool {
+	envName := c.EnvName(name)
+	_, isSet := os.LookupEnv(envName)
+	_, isFileSet := os.LookupEnv(envName + "_FILE")
+	return isSet || isFileSet
+}
+
+// AddStrProfile Same as AddProfile with type VtStr, so profile may be any profile in the chain.
 func (c *Config) AddStrProfile(profile, name, value string) {
-	if name == "" {
-		c.addErr(fmt.Errorf("propery name was nil; value=%s", value))
-		return
-	}
-	if c.Profile != profile {
-		return
-	}
-	c.Values[name] = value
+	c.AddProfile(VtStr, profile, name, value)
 }
 
 func (c *Config) addErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.Errors = append(c.Errors, err)
 }
 
+// ErrorList Returns copy of errors added so far.
+func (c *Config) ErrorList() []error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]error{}, c.Errors...)
+}
+
+// errCount Returns number of errors added so far, for use with errAfter.
+func (c *Config) errCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.Errors)
+}
+
+// errAfter Returns first error added after the first n, or nil.
+func (c *Config) errAfter(n int) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.Errors) > n {
+		return c.Errors[n]
+	}
+	return nil
+}
+
 ////// Get functions
 
 func (c *Config) Str(name string) string {
-	s, isFound := c.Values[name]
+	s, isFound := c.Lookup(name)
 	if !isFound {
 		log.Error().Str("name", name).Msg("property missing")
 	}
 	return s
 }
 
+// Lookup Returns value of name and false if it is missing.
+func (c *Config) Lookup(name string) (string, bool) {
+	c.markRead(name)
+	return c.lookup(name)
+}
+
+// MustStr Returns value of name or error if it is missing.
+func (c *Config) MustStr(name string) (string, error) {
+	return c.get(name)
+}
+
 func (c *Config) StrList(name string) []string {
+	c.markRead(name)
+	c.mu.RLock()
 	list, isFound := c.Lists[name]
+	c.mu.RUnlock()
 	if !isFound {
 		log.Error().Str("name", name).Msg("property missing")
 		list = []string{}
@@ -155,25 +336,103 @@ func (c *Config) Int(name string) int64 {
 	return n
 }
 
+func (c *Config) markRead(name string) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.reads[name] = true
+}
+
+// Unused Returns sorted names of values and lists that were added but never read. Call it when
+// the service has started to find dead config.
+func (c *Config) Unused() []string {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	unused := []string{}
+	for name := range c.Values {
+		if !c.reads[name] && name != "profile" {
+			unused = append(unused, name)
+		}
+	}
+	for name := range c.Lists {
+		if !c.reads[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// LogUnused Log a warning for each name returned by Unused.
+func (c *Config) LogUnused() {
+	for _, name := range c.Unused() {
+		log.Warn().Str("name", name).Msg("property never read")
+	}
+}
+
+// Require Declare keys that must have a value or list. Checked by LogAndValidate.
+func (c *Config) Require(names ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range names {
+		if !contains(c.required, name) {
+			c.required = append(c.required, name)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequired Add error for required keys that are missing, unless reported before.
+func (c *Config) checkRequired() {
+	c.mu.Lock()
+	var missing []string
+	for _, name := range c.required {
+		_, isValue := c.Values[name]
+		_, isList := c.Lists[name]
+		if !isValue && !isList && !c.missing[name] {
+			c.missing[name] = true
+			missing = append(missing, name)
+		}
+	}
+	c.mu.Unlock()
+	for _, name := range missing {
+		c.addErr(fmt.Errorf("property required; name=%s", name))
+	}
+}
+
 func (c *Config) LogAndValidate() (*Config, error) {
+	c.Interpolate()
+	c.checkRequired()
+	c.mu.RLock()
+	values := make(map[string]string, len(c.Values))
 	for k, v := range c.Values {
-		logNameValue(k, v)
+		values[k] = v
 	}
-	for i := range c.Errors {
-		log.Error().Err(c.Errors[i]).Msg("bad config")
+	c.mu.RUnlock()
+	for k, v := range values {
+		c.logNameValue(k, v)
 	}
-	if len(c.Errors) > 0 {
-		return c, c.Errors[0]
+	errs := c.ErrorList()
+	for i := range errs {
+		log.Error().Err(errs[i]).Msg("bad config")
+	}
+	if len(errs) > 0 {
+		return c, errs[0]
 	}
 	return c, nil
 }
 
-func logNameValue(name, value string) {
-	nameLower := strings.ToLower(name)
-	if strings.Contains(nameLower, "pwd") || strings.Contains(nameLower, "password") {
-		value = "***" // don't log passwords
-	}
-	log.Info().Str("name", name).Str("value", value).Msg("config")
+func (c *Config) logNameValue(name, value string) {
+	log.Info().Str("name", name).Str("value", c.redact(name, value)).Msg("config")
 }
 
 func isDir(path string) bool {
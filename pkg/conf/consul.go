@@ -0,0 +1,207 @@
+package conf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/myconsul"
+	"github.com/rs/zerolog/log"
+)
+
+// kvPollDelay Delay between queries when consul does not return an index to block on.
+const kvPollDelay = 10 * time.Second
+
+// ConsulPrefix Returns the KV prefix for a service and profile, e.g. "config/mam-search/prod/".
+func ConsulPrefix(service, profile string) string {
+	return fmt.Sprintf("config/%s/%s/", service, profile)
+}
+
+// LoadConsulKV Add all keys under prefix in consul KV. Key names are relative to prefix with / replaced by dot,
+// so config/mam-search/prod/db/host becomes db.host. Values are validated with the type the key was
+// added with earlier, VtStr if not added. Keys of lists hold one list value per line.
+func (c *Config) LoadConsulKV(client *http.Client, consulAddress, prefix string) error {
+	kv, err := myconsul.ListKV(client, consulAddress, prefix)
+	if err != nil {
+		c.addErr(err)
+		return err
+	}
+	for key, value := range kv {
+		name := kvName(key)
+		origin := Origin{Source: SrcConsul, Location: key}
+		if c.isList(name) {
+			if !c.replaceList(name, []string{}, origin) {
+				continue
+			}
+			for _, v := range splitLines(value) {
+				c.addListValue(c.typeOf(name), name, v, origin)
+			}
+			continue
+		}
+		c.addValue(c.typeOf(name), name, value, origin)
+	}
+	return nil
+}
+
+// WatchConsulKV Watch prefix in consul KV and hot reload the given keys when they change.
+// onChange, if not nil, is called after a key is updated, as are subscribers of the config. Subscribers
+// are also told of keys that reference the updated key, e.g. ${db.host}. Invalid values are logged and ignored.
+// Runs until ctx is done, so it is normally started as a goroutine.
+// Client timeout must be longer than myconsul.DefaultWait.
+func (c *Config) WatchConsulKV(ctx context.Context, client *http.Client, consulAddress, prefix string, keys []string, onChange func(name, value string)) {
+	watched := make(map[string]bool)
+	for _, k := range keys {
+		watched[k] = true
+	}
+
+	var index uint64
+	retryDelay := time.Second
+	for {
+		kv, newIndex, err := myconsul.FetchKV(ctx, client, consulAddress, prefix, index, myconsul.DefaultWait)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("prefix", prefix).Msg("failed watch consul config")
+			if !sleepContext(ctx, retryDelay) {
+				return
+			}
+			if retryDelay *= 2; retryDelay > 30*time.Second {
+				retryDelay = 30 * time.Second
+			}
+			continue
+		}
+		retryDelay = time.Second
+		if newIndex < index {
+			newIndex = 0 // index went backwards, consul says start over
+		}
+		index = newIndex
+
+		for key, value := range kv {
+			name := kvName(key)
+			if !watched[name] {
+				continue
+			}
+			changed := c.reload(name, value)
+			if len(changed) == 0 {
+				continue
+			}
+			if onChange != nil {
+				onChange(name, value)
+			}
+			c.notify(changed)
+		}
+		if index == 0 && !sleepContext(ctx, kvPollDelay) {
+			return // without an index the query does not block
+		}
+	}
+}
+
+// reload Update a single key and the keys referencing it. Returns sorted names of changed keys.
+func (c *Config) reload(name, value string) []string {
+	t := c.typeOf(name)
+	origin := Origin{Source: SrcConsul, Location: name}
+	raw, _ := c.rawValue(name)
+	if c.isList(name) {
+		list := splitLines(value)
+		for _, v := range list {
+			if err := c.checkValue(t, name, v); err != nil {
+				log.Error().Err(err).Msg("ignore reloaded config")
+				return nil
+			}
+		}
+		if strings.Join(list, "\n") == raw {
+			return nil
+		}
+		if !c.replaceList(name, list, origin) {
+			return nil
+		}
+		log.Info().Str("name", name).Msg("config list reloaded")
+		return c.reloadDependents(name)
+	}
+	value, _, err := c.envOverride(name, value)
+	if err == nil {
+		err = c.checkValue(t, name, value)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("ignore reloaded config")
+		return nil
+	}
+	if _, isFound := c.lookup(name); isFound && raw == value {
+		return nil
+	}
+	if !c.store(t, name, value, origin) {
+		return nil // env or flag wins
+	}
+	changed := c.reloadDependents(name)
+	value, _ = c.lookup(name)
+	c.logNameValue(name, value)
+	return changed
+}
+
+// reloadDependents Resolve references again after name was updated. Returns sorted names of name
+// and the keys whose resolved value changed.
+func (c *Config) reloadDependents(name string) []string {
+	resolved, _ := c.interpolate()
+	changed := []string{name}
+	for _, n := range resolved {
+		if n == name {
+			continue
+		}
+		changed = append(changed, n)
+		if value, isFound := c.lookup(n); isFound {
+			c.logNameValue(n, value)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func (c *Config) isList(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, isFound := c.Lists[name]
+	return isFound
+}
+
+// list Returns list without marking it as read.
+func (c *Config) list(name string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Lists[name]
+}
+
+func (c *Config) lookup(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, isFound := c.Values[name]
+	return v, isFound
+}
+
+func kvName(key string) string {
+	return strings.Replace(strings.Trim(key, "/"), "/", ".", -1)
+}
+
+func splitLines(value string) []string {
+	list := []string{}
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
+		}
+	}
+	return list
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,440 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// entry A value read from a config file.
+type entry struct {
+	profile string
+	name    string
+	value   string
+	list    bool
+	line    int
+}
+
+// LoadFile Add values from a config file. Format is given by suffix:
+// .conf and .properties (key=value), .json, .yaml/.yml or .toml.
+//
+// Profile values are added with AddProfile. They are in sections like [prod] in .conf, and in
+// objects under the reserved top-level key profiles in json, yaml and toml, e.g. profiles: {prod: {port: 1}}
+// or [profiles.prod]. Other objects and toml tables are flattened with dots, e.g. db: {host: x} or
+// [db] host = "x" gives db.host, so a file gives the same keys whatever the active profile. Arrays are added as lists, as are keys already added
+// as lists and .conf keys written as name[]. The first value of a list in a file replaces
+// values added earlier.
+//
+// Values have precedence over defaults but not over consul, env and flags, see Source.
+// Validation errors include file name and line number.
+func (c *Config) LoadFile(path string) error {
+	c.addFile(path)
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed read config file; %s", path)
+		c.addErr(err)
+		return err
+	}
+	var entries []entry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".conf", ".properties":
+		entries, err = parseProperties(bytes.NewReader(raw))
+	case ".json":
+		entries, err = parseJSON(raw)
+	case ".yaml", ".yml":
+		entries, err = parseYAML(raw)
+	case ".toml":
+		entries, err = parseTOML(bytes.NewReader(raw))
+	default:
+		err = errors.Errorf("unknown config file type")
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "failed parse config file; %s", path)
+		c.addErr(err)
+		return err
+	}
+	c.loadEntries(entries, path)
+	return nil
+}
+
+// profilesKey Reserved top-level key in json, yaml and toml files for profile sections.
+const profilesKey = "profiles"
+
+func (c *Config) loadEntries(entries []entry, file string) {
+	// values without profile first, so profile values win
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].profile == "" && entries[j].profile != ""
+	})
+	cleared := make(map[string]bool)
+	for _, e := range entries {
+		origin := Origin{Source: SrcFile, Location: fmt.Sprintf("%s:%d", file, e.line), Profile: e.profile}
+		t := c.typeOf(e.name)
+		if !e.list && !c.isList(e.name) {
+			c.addValue(t, e.name, e.value, origin)
+			continue
+		}
+		if key := e.profile + "/" + e.name; !cleared[key] && c.isActive(e.profile) {
+			cleared[key] = true
+			c.replaceList(e.name, []string{}, origin)
+		}
+		c.addListValue(t, e.name, e.value, origin)
+	}
+}
+
+// parseProperties Parse key=value lines. Lines starting with # or ; are comments, [name] starts a profile section.
+func parseProperties(r io.Reader) ([]entry, error) {
+	var entries []entry
+	profile := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") || strings.HasPrefix(text, "!") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			profile = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		index := strings.IndexAny(text, "=:")
+		if index <= 0 {
+			return nil, errors.Errorf("expected key=value; line=%d", line)
+		}
+		name := strings.TrimSpace(text[:index])
+		value := strings.TrimSpace(text[index+1:])
+		list := strings.HasSuffix(name, "[]")
+		if list {
+			name = strings.TrimSpace(strings.TrimSuffix(name, "[]"))
+		}
+		entries = append(entries, entry{profile: profile, name: name, value: value, list: list, line: line})
+	}
+	return entries, scanner.Err()
+}
+
+// parseJSON Parse json object. Uses token stream to know line numbers.
+func parseJSON(raw []byte) ([]entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	p := &jsonParser{dec: dec, raw: raw}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, errors.New("expected json object")
+	}
+	if err := p.object("", "", true); err != nil {
+		return nil, err
+	}
+	return p.entries, nil
+}
+
+type jsonParser struct {
+	dec     *json.Decoder
+	raw     []byte
+	entries []entry
+}
+
+func (p *jsonParser) line() int {
+	return bytes.Count(p.raw[:p.dec.InputOffset()], []byte("\n")) + 1
+}
+
+// object Read members of an object until its closing brace.
+func (p *jsonParser) object(profile, prefix string, top bool) error {
+	for p.dec.More() {
+		tok, err := p.dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		line := p.line()
+		tok, err = p.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			if v == '[' {
+				if err := p.array(profile, prefix+key, line); err != nil {
+					return err
+				}
+			} else if top && key == profilesKey {
+				if err := p.profiles(); err != nil {
+					return err
+				}
+			} else if err := p.object(profile, prefix+key+".", false); err != nil {
+				return err
+			}
+		default:
+			p.entries = append(p.entries, entry{profile: profile, name: prefix + key, value: jsonScalar(v), line: line})
+		}
+	}
+	_, err := p.dec.Token() // closing brace
+	return err
+}
+
+// profiles Read the object under profilesKey, where each member is a profile.
+func (p *jsonParser) profiles() error {
+	for p.dec.More() {
+		tok, err := p.dec.Token()
+		if err != nil {
+			return err
+		}
+		profile := tok.(string)
+		line := p.line()
+		tok, err = p.dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '{' {
+			return errors.Errorf("expected object for profile; profile=%s; line=%d", profile, line)
+		}
+		if err := p.object(profile, "", false); err != nil {
+			return err
+		}
+	}
+	_, err := p.dec.Token() // closing brace
+	return err
+}
+
+func (p *jsonParser) array(profile, name string, line int) error {
+	for p.dec.More() {
+		tok, err := p.dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(json.Delim); ok {
+			return errors.Errorf("nested arrays and objects not supported in list; name=%s; line=%d", name, line)
+		}
+		p.entries = append(p.entries, entry{profile: profile, name: name, value: jsonScalar(tok), list: true, line: p.line()})
+	}
+	_, err := p.dec.Token() // closing bracket
+	return err
+}
+
+func jsonScalar(tok json.Token) string {
+	switch v := tok.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseYAML Parse yaml mapping.
+func parseYAML(raw []byte) ([]entry, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.Errorf("expected yaml mapping; line=%d", root.Line)
+	}
+	var entries []entry
+	err := yamlMapping(root, "", "", true, &entries)
+	return entries, err
+}
+
+func yamlMapping(node *yaml.Node, profile, prefix string, top bool, entries *[]entry) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		name := prefix + key.Value
+		switch value.Kind {
+		case yaml.ScalarNode:
+			v := value.Value
+			if value.Tag == "!!null" {
+				v = ""
+			}
+			*entries = append(*entries, entry{profile: profile, name: name, value: v, line: key.Line})
+		case yaml.SequenceNode:
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return errors.Errorf("nested lists and mappings not supported in list; name=%s; line=%d", name, item.Line)
+				}
+				*entries = append(*entries, entry{profile: profile, name: name, value: item.Value, list: true, line: item.Line})
+			}
+		case yaml.MappingNode:
+			var err error
+			if top && key.Value == profilesKey {
+				err = yamlProfiles(value, entries)
+			} else {
+				err = yamlMapping(value, profile, name+".", false, entries)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("unsupported yaml value; name=%s; line=%d", name, value.Line)
+		}
+	}
+	return nil
+}
+
+// yamlProfiles Add values of the mapping under profilesKey, where each key is a profile.
+func yamlProfiles(node *yaml.Node, entries *[]entry) error {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.MappingNode {
+			return errors.Errorf("expected mapping for profile; profile=%s; line=%d", key.Value, key.Line)
+		}
+		if err := yamlMapping(value, key.Value, "", false, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTOML Parse the subset of toml used for config: [table] headers, key = value with
+// strings, numbers, booleans and arrays of those. Dates are kept as strings.
+// Tables are key prefixes, e.g. [db], except [profiles.<profile>] that starts a profile.
+func parseTOML(r io.Reader) ([]entry, error) {
+	var entries []entry
+	profile, prefix := "", ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			profile, prefix = tomlTable(strings.Trim(strings.TrimSpace(text[1:len(text)-1]), `"`))
+			continue
+		}
+		index := strings.Index(text, "=")
+		if index <= 0 {
+			return nil, errors.Errorf("expected key = value; line=%d", line)
+		}
+		name := prefix + strings.Trim(strings.TrimSpace(text[:index]), `"`)
+		raw := strings.TrimSpace(text[index+1:])
+
+		// arrays may continue over several lines
+		start := line
+		for strings.HasPrefix(raw, "[") && !strings.HasSuffix(raw, "]") && scanner.Scan() {
+			line++
+			raw += " " + strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		}
+		if strings.HasPrefix(raw, "[") {
+			values, err := tomlArray(raw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "bad array; line=%d", start)
+			}
+			for _, v := range values {
+				entries = append(entries, entry{profile: profile, name: name, value: v, list: true, line: start})
+			}
+			continue
+		}
+		value, err := tomlValue(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad value; line=%d", line)
+		}
+		entries = append(entries, entry{profile: profile, name: name, value: value, line: line})
+	}
+	return entries, scanner.Err()
+}
+
+// tomlTable Returns profile and key prefix of a table, e.g. profiles.prod.db gives prod and db.
+func tomlTable(table string) (string, string) {
+	if !strings.HasPrefix(table, profilesKey+".") {
+		return "", table + "."
+	}
+	parts := strings.SplitN(strings.TrimPrefix(table, profilesKey+"."), ".", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1] + "."
+}
+
+func tomlValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		return strconv.Unquote(raw)
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", errors.Errorf("unterminated string; %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case strings.HasPrefix(raw, "{"):
+		return "", errors.New("inline tables not supported")
+	default:
+		return strings.Replace(raw, "_", "", -1), nil // number, bool or date
+	}
+}
+
+func tomlArray(raw string) ([]string, error) {
+	inner := strings.TrimSpace(raw[1 : len(raw)-1])
+	values := []string{}
+	for inner != "" {
+		var item string
+		if inner[0] == '"' || inner[0] == '\'' {
+			end := closingQuote(inner)
+			if end < 0 {
+				return nil, errors.Errorf("unterminated string; %s", inner)
+			}
+			item, inner = inner[:end+1], inner[end+1:]
+		} else if index := strings.Index(inner, ","); index >= 0 {
+			item, inner = inner[:index], inner[index:]
+		} else {
+			item, inner = inner, ""
+		}
+		value, err := tomlValue(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		inner = strings.TrimSpace(inner)
+		inner = strings.TrimSpace(strings.TrimPrefix(inner, ","))
+	}
+	return values, nil
+}
+
+// closingQuote Returns index of quote ending the string s starts with.
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+func stripTOMLComment(line string) string {
+	inString := byte(0)
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case inString != 0 && ch == '\\' && inString == '"':
+			i++
+		case inString != 0 && ch == inString:
+			inString = 0
+		case inString == 0 && (ch == '"' || ch == '\''):
+			inString = ch
+		case inString == 0 && ch == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
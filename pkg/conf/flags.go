@@ -0,0 +1,147 @@
+package conf
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SetEnvPrefix Read env overrides from prefix_KEY instead of the raw key name, so keys don't collide
+// with system variables like PATH. With prefix MYSVC, my.key and myKey are read from MYSVC_MY_KEY.
+// Call before values are added.
+func (c *Config) SetEnvPrefix(prefix string) {
+	c.envPrefix = strings.TrimSuffix(prefix, "_")
+}
+
+// EnvName Returns name of the env variable that overrides key name.
+func (c *Config) EnvName(name string) string {
+	if c.envPrefix == "" {
+		return name
+	}
+	return c.envPrefix + "_" + envKey(name)
+}
+
+// envKey Returns name in upper case with words separated by underscore, e.g. db.maxConns is DB_MAX_CONNS.
+func envKey(name string) string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, r := range name {
+		switch {
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			b.WriteRune('_')
+			b.WriteRune(r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			r = '_'
+			b.WriteRune(r)
+		}
+		prev = r
+	}
+	return b.String()
+}
+
+// ParseFlags Add values from command line flags --key=value and --key value, e.g. os.Args[1:].
+// Flags have precedence over all other sources, see Source. Only keys already added can be set, so
+// call it after other sources are loaded. A VtBool flag without = is true. List keys may be given
+// several times and replace the list. Arguments after -- and arguments not starting with -- are returned.
+// On -h or --help, Usage is written to stdout and flag.ErrHelp returned.
+// Call it once, after Load. The args are kept and parsed again on each Reload, so flags keep their
+// precedence. If the loader calls ParseFlags itself, Reload does not parse the kept args again.
+func (c *Config) ParseFlags(args []string) ([]string, error) {
+	c.mu.Lock()
+	c.flagArgs = append(c.flagArgs, args...)
+	c.mu.Unlock()
+	before := c.errCount()
+	rest := []string{}
+	cleared := make(map[string]bool)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+		if arg == "-h" || arg == "-help" || arg == "--help" {
+			c.Usage(os.Stdout)
+			return rest, flag.ErrHelp
+		}
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+		name, value := arg[2:], ""
+		index := strings.Index(name, "=")
+		if index >= 0 {
+			name, value = name[:index], name[index+1:]
+		}
+		t, isKnown := c.knownType(name)
+		if !isKnown {
+			c.addErr(fmt.Errorf("unknown flag; name=%s", name))
+			continue
+		}
+		if index < 0 {
+			if t == VtBool {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				c.addErr(fmt.Errorf("flag needs value; name=%s", name))
+				continue
+			}
+		}
+		origin := Origin{Source: SrcFlag, Location: "--" + name}
+		if c.isList(name) {
+			if !cleared[name] {
+				cleared[name] = true
+				c.replaceList(name, []string{}, origin)
+			}
+			c.addListValue(t, name, value, origin)
+		} else {
+			c.addValue(t, name, value, origin)
+		}
+	}
+	return rest, c.errAfter(before)
+}
+
+// knownType Returns type of a key that has been added.
+func (c *Config) knownType(name string) (ValueType, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, isFound := c.types[name]
+	return t, isFound
+}
+
+// Usage Write all keys with type, env variable and current value as help for ParseFlags.
+func (c *Config) Usage(w io.Writer) {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.types))
+	for name := range c.types {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "Usage of %s:\n", os.Args[0])
+	for _, name := range names {
+		t := c.typeOf(name)
+		kind := t.String()
+		value, isFound := c.lookup(name)
+		if c.isList(name) {
+			kind = "list of " + kind
+			value, isFound = strings.Join(c.list(name), ","), true
+		}
+		fmt.Fprintf(w, "  --%s %s\n    \tenv %s", name, kind, c.EnvName(name))
+		if isFound {
+			fmt.Fprintf(w, "; value %s", c.redact(name, value))
+		}
+		if t == VtEnum {
+			fmt.Fprintf(w, "; one of %s", strings.Join(c.enumValues(name), "|"))
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,95 @@
+package conf
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Dump Effective config as served by Handler. Secrets are redacted like in the log.
+type Dump struct {
+	Profile      string               `json:"profile"`
+	ProfileChain []string             `json:"profileChain"`
+	Values       map[string]DumpValue `json:"values"`
+	Lists        map[string]DumpList  `json:"lists"`
+	Errors       []string             `json:"errors"`
+}
+
+// DumpValue A value with its type and origin.
+type DumpValue struct {
+	Value    string `json:"value"`
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Location string `json:"location,omitempty"`
+	Profile  string `json:"profile,omitempty"`
+}
+
+// DumpList A list with its type and origin.
+type DumpList struct {
+	Values   []string `json:"values"`
+	Type     string   `json:"type"`
+	Source   string   `json:"source"`
+	Location string   `json:"location,omitempty"`
+	Profile  string   `json:"profile,omitempty"`
+}
+
+// Dump Returns a snapshot of the effective config with secrets redacted.
+func (c *Config) Dump() Dump {
+	c.mu.RLock()
+	values := make(map[string]string, len(c.Values))
+	for name, value := range c.Values {
+		values[name] = value
+	}
+	lists := make(map[string][]string, len(c.Lists))
+	for name, list := range c.Lists {
+		lists[name] = append([]string{}, list...)
+	}
+	c.mu.RUnlock()
+
+	d := Dump{
+		Profile:      c.Profile,
+		ProfileChain: c.ProfileChain(),
+		Values:       make(map[string]DumpValue, len(values)),
+		Lists:        make(map[string]DumpList, len(lists)),
+		Errors:       []string{},
+	}
+	for name, value := range values {
+		origin, _ := c.Origin(name)
+		d.Values[name] = DumpValue{
+			Value:    c.redact(name, value),
+			Type:     c.typeOf(name).String(),
+			Source:   origin.Source.String(),
+			Location: origin.Location,
+			Profile:  origin.Profile,
+		}
+	}
+	for name, list := range lists {
+		for i := range list {
+			list[i] = c.redact(name, list[i])
+		}
+		origin, _ := c.Origin(name)
+		d.Lists[name] = DumpList{
+			Values:   list,
+			Type:     c.typeOf(name).String(),
+			Source:   origin.Source.String(),
+			Location: origin.Location,
+			Profile:  origin.Profile,
+		}
+	}
+	for _, err := range c.ErrorList() {
+		d.Errors = append(d.Errors, err.Error())
+	}
+	return d
+}
+
+// Handler Returns a http handler rendering Dump as json, e.g. mounted next to version.CreateHealthHandler.
+func (c *Config) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawJSON, err := json.MarshalIndent(c.Dump(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write(rawJSON)
+	})
+}
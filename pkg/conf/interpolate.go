@@ -0,0 +1,294 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Interpolate Replace ${other.key} in values and lists with the value of other.key and ${env:NAME:-default}
+// with env variable NAME, or default if it is unset or empty. Type validation of values containing ${
+// is done here instead of when they are added. Errors, e.g. missing keys and cycles, are added to Errors
+// and the value is left as is. Called by LogAndValidate, Reload and Bind, so it is normally not called directly.
+// Use $${ for a literal ${. Values of VtSecret keys and files given by env NAME_FILE are never interpolated.
+//
+// Values are kept as added, so a later call resolves them again, e.g. when WatchConsulKV reloads a key
+// they reference. Values referencing a secret or redacted key are redacted too.
+func (c *Config) Interpolate() error {
+	_, err := c.interpolate()
+	return err
+}
+
+// interpolate Same as Interpolate. Also returns sorted names of keys whose resolved value changed.
+func (c *Config) interpolate() ([]string, error) {
+	before := c.errCount()
+	c.mu.RLock()
+	values := make(map[string]string, len(c.Values))
+	for name, value := range c.Values {
+		values[name] = value
+	}
+	for name, raw := range c.rawValues {
+		values[name] = raw
+	}
+	lists := make(map[string][]string)
+	for name, list := range c.Lists {
+		if raw, isFound := c.rawLists[name]; isFound {
+			list = raw
+		}
+		for _, value := range list {
+			if strings.Contains(value, "${") {
+				lists[name] = append([]string{}, list...)
+				break
+			}
+		}
+	}
+	failed := make(map[string]string, len(c.failed))
+	for name, raw := range c.failed {
+		failed[name] = raw
+	}
+	c.mu.RUnlock()
+
+	changed := []string{}
+	r := &interpolator{values: values, resolved: make(map[string]string), visiting: make(map[string]bool)}
+	for name, value := range values {
+		if c.isLiteral(name) {
+			r.resolved[name] = value // referenced as is
+		}
+	}
+	for name, value := range values {
+		if !strings.Contains(value, "${") || failed[name] == value || c.isLiteral(name) {
+			continue
+		}
+		resolved, err := r.resolve(name)
+		if err != nil {
+			c.interpolateErr(name, value, c.interpolateFailed(name, err))
+			continue
+		}
+		if err := c.checkValue(c.typeOf(name), name, resolved); err != nil {
+			c.interpolateErr(name, value, err)
+			continue
+		}
+		if c.replaceValue(name, value, resolved) {
+			changed = append(changed, name)
+		}
+	}
+	for name, list := range lists {
+		raw := strings.Join(list, "\n")
+		if failed[name] == raw || c.isLiteral(name) {
+			continue
+		}
+		resolved := make([]string, len(list))
+		var err error
+		for i, value := range list {
+			if resolved[i], err = r.expand(value); err != nil {
+				err = c.interpolateFailed(name, err)
+				break
+			}
+			if err = c.checkValue(c.typeOf(name), name, resolved[i]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			c.interpolateErr(name, raw, err)
+			continue
+		}
+		if c.replaceResolvedList(name, list, resolved) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, c.errAfter(before)
+}
+
+// isLiteral Returns true if the value of name is used as is: secrets and content of env NAME_FILE files.
+func (c *Config) isLiteral(name string) bool {
+	if c.typeOf(name) == VtSecret {
+		return true
+	}
+	origin, _ := c.Origin(name)
+	return origin.Source == SrcEnv && strings.HasSuffix(origin.Location, "_FILE")
+}
+
+// interpolateFailed Returns error for name. Details are left out for secret keys, since e.g. a missing
+// reference is part of the value.
+func (c *Config) interpolateFailed(name string, err error) error {
+	if c.isSecret(name, make(map[string]bool)) {
+		return fmt.Errorf("failed interpolate; name=%s; value=%s", name, redacted)
+	}
+	return fmt.Errorf("failed interpolate; name=%s; %v", name, err)
+}
+
+// interpolateErr Add err unless it was added for the same raw value before.
+func (c *Config) interpolateErr(name, raw string, err error) {
+	origin, _ := c.Origin(name)
+	c.addErr(withSource(err, origin.Location))
+	c.mu.Lock()
+	c.failed[name] = raw
+	c.mu.Unlock()
+}
+
+// replaceValue Set resolved value and keep raw, if the raw value was not changed meanwhile.
+// Returns true if the resolved value changed.
+func (c *Config) replaceValue(name, raw, resolved string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, isFound := c.rawValues[name]
+	if !isFound {
+		current = c.Values[name]
+	}
+	if current != raw {
+		return false
+	}
+	c.rawValues[name] = raw
+	if c.Values[name] == resolved {
+		return false
+	}
+	c.Values[name] = resolved
+	return true
+}
+
+// replaceResolvedList Same as replaceValue for lists.
+func (c *Config) replaceResolvedList(name string, raw, resolved []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current, isFound := c.rawLists[name]
+	if !isFound {
+		current = c.Lists[name]
+	}
+	if strings.Join(current, "\n") != strings.Join(raw, "\n") {
+		return false
+	}
+	c.rawLists[name] = raw
+	if strings.Join(c.Lists[name], "\n") == strings.Join(resolved, "\n") {
+		return false
+	}
+	c.Lists[name] = resolved
+	return true
+}
+
+// rawValue Returns value or list of name as added, before Interpolate. Lists are joined by newline.
+func (c *Config) rawValue(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if raw, isFound := c.rawValues[name]; isFound {
+		return raw, true
+	}
+	if raw, isFound := c.rawLists[name]; isFound {
+		return strings.Join(raw, "\n"), true
+	}
+	if value, isFound := c.Values[name]; isFound {
+		return value, true
+	}
+	list, isFound := c.Lists[name]
+	return strings.Join(list, "\n"), isFound
+}
+
+// references Returns keys referenced by ${key} in s. Env references are returned as env:NAME.
+func references(s string) []string {
+	refs := []string{}
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			return refs
+		}
+		if isEscaped(s, start) {
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return refs
+		}
+		expr := s[start+2 : start+end]
+		if strings.HasPrefix(expr, "env:") {
+			if index := strings.Index(expr, ":-"); index >= 0 {
+				expr = expr[:index]
+			}
+		}
+		refs = append(refs, expr)
+		s = s[start+end+1:]
+	}
+}
+
+type interpolator struct {
+	values   map[string]string
+	resolved map[string]string
+	visiting map[string]bool
+	stack    []string
+}
+
+// resolve Returns value of name with references expanded.
+func (r *interpolator) resolve(name string) (string, error) {
+	if value, isFound := r.resolved[name]; isFound {
+		return value, nil
+	}
+	if r.visiting[name] {
+		return "", fmt.Errorf("interpolation cycle; path=%s -> %s", strings.Join(r.stack, " -> "), name)
+	}
+	r.visiting[name] = true
+	r.stack = append(r.stack, name)
+	value, err := r.expand(r.values[name])
+	delete(r.visiting, name)
+	r.stack = r.stack[:len(r.stack)-1]
+	if err != nil {
+		return "", err
+	}
+	r.resolved[name] = value
+	return value, nil
+}
+
+// expand Returns s with all ${...} replaced.
+func (r *interpolator) expand(s string) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if isEscaped(s, start) {
+			b.WriteString(s[:start-1])
+			b.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("interpolation not terminated")
+		}
+		b.WriteString(s[:start])
+		expr := s[start+2 : start+end]
+		s = s[start+end+1:]
+
+		if strings.HasPrefix(expr, "env:") {
+			b.WriteString(envDefault(expr[len("env:"):]))
+			continue
+		}
+		if _, isFound := r.values[expr]; !isFound {
+			return "", fmt.Errorf("interpolation key missing; ref=%s", expr)
+		}
+		value, err := r.resolve(expr)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+	}
+}
+
+// isEscaped Returns true if ${ at index start of s is written $${.
+func isEscaped(s string, start int) bool {
+	return start > 0 && s[start-1] == '$'
+}
+
+// envDefault Returns env variable for expr NAME or NAME:-default.
+func envDefault(expr string) string {
+	name, def := expr, ""
+	if index := strings.Index(expr, ":-"); index >= 0 {
+		name, def = expr[:index], expr[index+2:]
+	}
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
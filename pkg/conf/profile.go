@@ -0,0 +1,147 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source Kind of source a value came from. When a key is added from several sources the value from
+// the source of highest precedence is used, regardless of the order they were added in:
+//
+//	SrcDefault < SrcFile < SrcConsul < SrcEnv < SrcFlag
+//
+// Within a source a value for a more specific profile wins, e.g. prod-eu over prod over the default profile "".
+// With same source and profile the value added last wins.
+type Source int
+
+const (
+	SrcDefault Source = iota // added by code with Add, AddProfile or Bind defaults
+	SrcFile                  // LoadFile and secret files
+	SrcConsul                // LoadConsulKV and WatchConsulKV
+	SrcEnv                   // env variable with the key name, or name_FILE
+	SrcFlag                  // command line flag
+)
+
+func (s Source) String() string {
+	switch s {
+	case SrcDefault:
+		return "default"
+	case SrcFile:
+		return "file"
+	case SrcConsul:
+		return "consul"
+	case SrcEnv:
+		return "env"
+	case SrcFlag:
+		return "flag"
+	default:
+		return "unknown"
+	}
+}
+
+// Origin Where an effective value came from.
+type Origin struct {
+	Source   Source
+	Location string // e.g. file:line, consul key or env variable. Empty for defaults.
+	Profile  string // profile the value was added for, "" for default profile
+}
+
+func (o Origin) String() string {
+	s := o.Source.String()
+	if o.Location != "" {
+		s += " " + o.Location
+	}
+	if o.Profile != "" {
+		s += fmt.Sprintf(" (profile %s)", o.Profile)
+	}
+	return s
+}
+
+// Origin Returns where the effective value or list of name came from.
+func (c *Config) Origin(name string) (Origin, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	origin, isFound := c.origins[name]
+	return origin, isFound
+}
+
+// profileChain Returns profiles inherited by profile from its name, e.g. prod-eu-west, prod-eu, prod and "".
+func profileChain(profile string) []string {
+	chain := []string{}
+	for p := profile; p != ""; {
+		chain = append(chain, p)
+		index := strings.LastIndex(p, "-")
+		if index < 0 {
+			break
+		}
+		p = p[:index]
+	}
+	return append(chain, "")
+}
+
+// Inherit Set profiles the active profile inherits values from, closest first, e.g. Inherit("prod")
+// for profile eu-prod. Replaces the chain derived from the profile name. Call before values are added.
+func (c *Config) Inherit(parents ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.chain = append(append([]string{c.Profile}, parents...), "")
+}
+
+// ProfileChain Returns active profiles, most specific first. Last is the default profile "".
+func (c *Config) ProfileChain() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string{}, c.chain...)
+}
+
+// isActive Returns true if values of profile should be used.
+func (c *Config) isActive(profile string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.profileRank(profile) >= 0
+}
+
+// profileRank Returns higher rank for more specific profiles, -1 if profile is not active. Caller holds mu.
+func (c *Config) profileRank(profile string) int {
+	for i, p := range c.chain {
+		if p == profile {
+			return len(c.chain) - i
+		}
+	}
+	return -1
+}
+
+// precedes Returns true if a value from a wins over one from b. Caller holds mu.
+func (c *Config) precedes(a, b Origin) bool {
+	if a.Source != b.Source {
+		return a.Source > b.Source
+	}
+	return c.profileRank(a.Profile) > c.profileRank(b.Profile)
+}
+
+// store Set value unless current value has an origin of higher precedence. Returns true if set.
+func (c *Config) store(t ValueType, name, value string, origin Origin) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, isFound := c.origins[name]; isFound && c.precedes(current, origin) {
+		return false
+	}
+	c.Values[name] = value
+	delete(c.rawValues, name)
+	c.types[name] = t
+	c.origins[name] = origin
+	return true
+}
+
+// replaceList Set list unless current list has an origin of higher precedence. Returns true if set.
+func (c *Config) replaceList(name string, list []string, origin Origin) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, isFound := c.origins[name]; isFound && c.precedes(current, origin) {
+		return false
+	}
+	c.Lists[name] = list
+	delete(c.rawLists, name)
+	c.origins[name] = origin
+	return true
+}
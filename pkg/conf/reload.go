@@ -0,0 +1,234 @@
+package conf
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Loader Adds all values of a config, e.g. with Add, LoadFile and LoadConsulKV. Called by Load and
+// again on each Reload with a new empty Config.
+type Loader func(c *Config)
+
+// Load Create config for profile, add values with load and validate. The config can be reloaded
+// with Reload, WatchFiles or ReloadOnSignal. Values are logged before a later Bind, so use LoadBind
+// for keys only declared secret by a bind tag.
+func Load(profile string, load Loader) (*Config, error) {
+	c := NewConfig(profile)
+	c.loader = load
+	load(c)
+	return c.LogAndValidate()
+}
+
+// LoadBind Same as Load, then Bind v. Types from the tags of v, e.g. type=secret, are known before
+// values are added and logged.
+func LoadBind(profile string, load Loader, v interface{}) (*Config, error) {
+	c := NewConfig(profile)
+	c.loader = load
+	c.bindTypes(v)
+	load(c)
+	if _, err := c.LogAndValidate(); err != nil {
+		return c, err
+	}
+	return c, c.Bind(v)
+}
+
+// Subscribe Register fn to be called with sorted names of keys changed by a reload.
+// Keys hot reloaded by WatchConsulKV are also notified.
+func (c *Config) Subscribe(fn func(changed []string)) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	c.subscribers = append(c.subscribers, fn)
+}
+
+func (c *Config) notify(changed []string) {
+	if len(changed) == 0 {
+		return
+	}
+	c.subMu.Lock()
+	subscribers := append([]func([]string){}, c.subscribers...)
+	c.subMu.Unlock()
+	for _, fn := range subscribers {
+		fn(changed)
+	}
+}
+
+// Reload Run the loader of a config created by Load on a new snapshot and parse the args given to
+// ParseFlags again, unless the loader parses flags. Keys set with Require, SetEnum and Bind, also after Load, are kept, and defaults of
+// bound keys are added again. If the snapshot is valid it replaces all values and lists at once and subscribers
+// are notified of changed keys. The maps Values and Lists are replaced, so read values with the
+// getters once a config can be reloaded. If not, current values are kept and the first error is returned.
+func (c *Config) Reload() error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	if c.loader == nil {
+		return errors.New("config not created by Load, can not reload")
+	}
+
+	n := NewConfig(c.Profile)
+	n.Redact = c.Redact
+	n.chain = c.ProfileChain()
+	n.envPrefix = c.envPrefix
+	c.mu.RLock()
+	args := append([]string{}, c.flagArgs...)
+	for name, t := range c.bound {
+		n.bound[name] = t
+	}
+	for name, values := range c.enums {
+		n.enums[name] = values
+	}
+	for name, bt := range c.bindings {
+		n.bindings[name] = bt
+	}
+	n.required = append(n.required, c.required...)
+	c.mu.RUnlock()
+	c.loader(n)
+	n.mu.RLock()
+	parsed := len(n.flagArgs) > 0 // loader called ParseFlags
+	n.mu.RUnlock()
+	if len(args) > 0 && !parsed {
+		n.ParseFlags(args) // errors are in n.Errors
+	}
+	for _, bt := range n.bindings {
+		n.addBindDefault(bt)
+		if bt.required {
+			n.Require(bt.name)
+		}
+	}
+	n.Interpolate()
+	n.checkRequired()
+	if len(n.Errors) > 0 {
+		for _, err := range n.Errors {
+			log.Error().Err(err).Msg("bad reloaded config, keeping current")
+		}
+		return n.Errors[0]
+	}
+
+	c.mu.Lock()
+	changed := changedKeys(c, n)
+	c.Values = n.Values
+	c.Lists = n.Lists
+	c.types = n.types
+	c.bound = n.bound
+	c.bindings = n.bindings
+	c.origins = n.origins
+	c.enums = n.enums
+	c.required = n.required
+	c.files = n.files
+	c.failed = n.failed
+	c.missing = n.missing
+	c.rawValues = n.rawValues
+	c.rawLists = n.rawLists
+	c.mu.Unlock()
+
+	for _, name := range changed {
+		if value, isFound := c.lookup(name); isFound {
+			c.logNameValue(name, value)
+		}
+	}
+	log.Info().Strs("changed", changed).Msg("config reloaded")
+	c.notify(changed)
+	return nil
+}
+
+// changedKeys Returns sorted names of values and lists added, removed or changed in n.
+func changedKeys(old, n *Config) []string {
+	changed := []string{}
+	for name, value := range n.Values {
+		if oldValue, isFound := old.Values[name]; !isFound || oldValue != value {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old.Values {
+		if _, isFound := n.Values[name]; !isFound {
+			changed = append(changed, name)
+		}
+	}
+	for name, list := range n.Lists {
+		if oldList, isFound := old.Lists[name]; !isFound || strings.Join(oldList, "\n") != strings.Join(list, "\n") {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old.Lists {
+		if _, isFound := n.Lists[name]; !isFound {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// addFile Remember a file values were read from, for WatchFiles.
+func (c *Config) addFile(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files = append(c.files, path)
+}
+
+// WatchFiles Reload when a file read by LoadFile or AddSecretFile is modified. Files are checked every interval.
+// Runs until ctx is done, so it is normally started as a goroutine.
+func (c *Config) WatchFiles(ctx context.Context, interval time.Duration) {
+	modified := c.fileTimes()
+	for sleepContext(ctx, interval) {
+		current := c.fileTimes()
+		if !sameTimes(modified, current) {
+			if err := c.Reload(); err != nil {
+				log.Error().Err(err).Msg("failed reload config")
+			}
+			// also after failure, so a bad file is not reloaded again until it is changed
+			modified = c.fileTimes()
+		}
+	}
+}
+
+func (c *Config) fileTimes() map[string]time.Time {
+	c.mu.RLock()
+	files := append([]string{}, c.files...)
+	c.mu.RUnlock()
+	times := make(map[string]time.Time, len(files))
+	for _, path := range files {
+		if f, err := os.Stat(path); err == nil {
+			times[path] = f.ModTime()
+		}
+	}
+	return times
+}
+
+func sameTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if !b[path].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReloadOnSignal Reload when the process gets SIGHUP, until ctx is done.
+func (c *Config) ReloadOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				log.Info().Msg("reloading config on SIGHUP")
+				if err := c.Reload(); err != nil {
+					log.Error().Err(err).Msg("failed reload config")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
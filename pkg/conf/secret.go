@@ -0,0 +1,88 @@
+package conf
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRedact Name patterns redacted by new Configs. Change Config.Redact to use other patterns.
+var DefaultRedact = []string{"pwd", "password", "passwd", "secret", "token", "apikey", "api_key", "credential", "dsn", "private"}
+
+const redacted = "***"
+
+// redact Returns value, or *** for secrets, keys matching a redact pattern and keys referencing those.
+func (c *Config) redact(name, value string) string {
+	if c.isSecret(name, make(map[string]bool)) {
+		return redacted
+	}
+	return value
+}
+
+// isSecret Returns true if name is VtSecret, matches a redact pattern or its raw value references
+// such a key, e.g. db.url=postgres://u:${db.password}@h. seen stops reference cycles.
+func (c *Config) isSecret(name string, seen map[string]bool) bool {
+	if seen[name] {
+		return false
+	}
+	seen[name] = true
+	if c.typeOf(name) == VtSecret {
+		return true
+	}
+	nameLower := strings.ToLower(name)
+	for _, pattern := range c.Redact {
+		if strings.Contains(nameLower, pattern) {
+			return true
+		}
+	}
+	raw, _ := c.rawValue(name)
+	for _, ref := range references(raw) {
+		if c.isSecret(ref, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSecretFile Add content of a file as VtSecret, e.g. a docker secret in /run/secrets.
+func (c *Config) AddSecretFile(profile, name, path string) {
+	if !c.isActive(profile) {
+		return
+	}
+	c.addFile(path)
+	value, err := readSecretFile(path)
+	if err != nil {
+		c.addErr(err)
+		return
+	}
+	c.addValue(VtSecret, name, value, Origin{Source: SrcFile, Location: path, Profile: profile})
+}
+
+// LoadSecretDir Add each file in dir as VtSecret named by the file, e.g. a kubernetes secret volume.
+// Hidden files are skipped.
+func (c *Config) LoadSecretDir(profile, dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		err = errors.Wrapf(err, "failed read secret dir; %s", dir)
+		c.addErr(err)
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		c.AddSecretFile(profile, f.Name(), filepath.Join(dir, f.Name()))
+	}
+	return nil
+}
+
+// readSecretFile Returns file content without trailing newline.
+func readSecretFile(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed read secret file; %s", path)
+	}
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+type dbConf struct {
+	Host string `conf:"host,required"`
+	Port int    `conf:"port,default=5432"`
+}
+
+type svcConf struct {
+	Port    int           `conf:"port,type=int,required,default=8080"`
+	Log     string        `conf:"log,default=debug"`
+	Timeout time.Duration `conf:"timeout,default=2s"`
+	Hosts   []string      `conf:"hosts,default=a|b"`
+	Weights []int         `conf:"weights"`
+	DB      dbConf        `conf:"db"`
+	Ignored string        `conf:"-"`
+}
+
+func TestBind(t *testing.T) {
+	c := conf.NewConfig("prod")
+	c.Add(conf.VtStr, "db.host", "pg1")
+	c.AddProfile(conf.VtStr, "prod", "log", "warn")
+	c.AddList(conf.VtInt, "weights", "1")
+	c.AddList(conf.VtInt, "weights", "2")
+
+	var s svcConf
+	if err := c.Bind(&s); err != nil {
+		t.Fatalf("bind failed; err=%v", err)
+	}
+	if s.Port != 8080 || s.Log != "warn" || s.Timeout != 2*time.Second {
+		t.Errorf("bad values; got=%+v", s)
+	}
+	if strings.Join(s.Hosts, ",") != "a,b" || len(s.Weights) != 2 || s.Weights[1] != 2 {
+		t.Errorf("bad lists; hosts=%v; weights=%v", s.Hosts, s.Weights)
+	}
+	if s.DB.Host != "pg1" || s.DB.Port != 5432 {
+		t.Errorf("bad nested; got=%+v", s.DB)
+	}
+	if c.Str("port") != "8080" {
+		t.Errorf("default not added to config; got=%s", c.Str("port"))
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtStr, "port", "eighty")
+
+	var s svcConf
+	if err := c.Bind(&s); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(c.Errors) != 2 {
+		t.Fatalf("expected invalid port and missing db.host; got=%v", c.Errors)
+	}
+	if !strings.Contains(c.Errors[0].Error(), "name=port") || !strings.Contains(c.Errors[1].Error(), "name=db.host") {
+		t.Errorf("unexpected errors; got=%v", c.Errors)
+	}
+	if err := c.Bind(s); err == nil {
+		t.Error("expected error binding non pointer")
+	}
+}
+
+func TestBindSecretFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := conf.NewConfig("")
+	c.LoadFile(writeFile(t, dir, "svc.conf", "db.login = pg-login\n"))
+	var s struct {
+		Login string `conf:"db.login,type=secret"`
+	}
+	if err := c.Bind(&s); err != nil || s.Login != "pg-login" {
+		t.Fatalf("bind failed; got=%+v; err=%v", s, err)
+	}
+	if v := c.Dump().Values["db.login"]; v.Value != "***" || v.Type != "secret" {
+		t.Errorf("secret from file not redacted; got=%+v", v)
+	}
+	buf, restore := captureLog()
+	defer restore()
+	c.LogAndValidate()
+	if strings.Contains(buf.String(), "pg-login") {
+		t.Errorf("secret from file logged; log=%s", buf.String())
+	}
+}
+
+func TestLoadBindSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "svc.conf", "upstream.auth = first\n")
+
+	buf, restore := captureLog()
+	defer restore()
+	var s struct {
+		Auth string `conf:"upstream.auth,type=secret"`
+	}
+	c, err := conf.LoadBind("", func(c *conf.Config) { c.LoadFile(path) }, &s)
+	if err != nil || s.Auth != "first" {
+		t.Fatalf("load failed; got=%+v; err=%v", s, err)
+	}
+	if strings.Contains(buf.String(), "first") {
+		t.Errorf("secret logged by Load; log=%s", buf.String())
+	}
+
+	// bound type is kept by Reload
+	writeFile(t, dir, "svc.conf", "upstream.auth = n3wsecret\n")
+	if err := c.Reload(); err != nil {
+		t.Fatalf("reload failed; err=%v", err)
+	}
+	if strings.Contains(buf.String(), "n3wsecret") {
+		t.Errorf("secret logged by Reload; log=%s", buf.String())
+	}
+	if v := c.Dump().Values["upstream.auth"]; v.Value != "***" || v.Type != "secret" {
+		t.Errorf("reloaded secret not redacted; got=%+v", v)
+	}
+}
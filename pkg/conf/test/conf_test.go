@@ -48,16 +48,16 @@ func TestAddGet(t *testing.T) {
 		if d.value != value {
 			t.Errorf("unexpected value; n=%s; v=%s; got=%s", d.name, d.value, value)
 		}
-		if d.t == conf.VtInt && toInt(d.value) != toInt(value) {
-			t.Errorf("unexpected int value; n=%s; v=%d; got=%d", d.name, toInt(d.value), toInt(value))
+		if d.t == conf.VtInt && toInt(t, d.value) != toInt(t, value) {
+			t.Errorf("unexpected int value; n=%s; v=%d; got=%d", d.name, toInt(t, d.value), toInt(t, value))
 		}
 	}
 }
 
-func toInt(s string) int64 {
+func toInt(t *testing.T, s string) int64 {
 	n, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		fmt.Errorf("failed parse int; %s", s)
+		t.Logf("failed parse int; %s", s)
 		return -1000000 - rand.Int63n(1000000)
 	}
 	return n
@@ -105,6 +105,49 @@ func TestBadInt(t *testing.T) {
 	}
 }
 
+func TestLookupMissing(t *testing.T) {
+	c := conf.NewConfig("")
+	c.Add(conf.VtStr, "name", "value")
+	if v, ok := c.Lookup("name"); !ok || v != "value" {
+		t.Errorf("unexpected lookup; v=%s; ok=%v", v, ok)
+	}
+	if _, ok := c.Lookup("nmae"); ok {
+		t.Errorf("lookup of missing key should fail")
+	}
+	if _, err := c.MustStr("nmae"); err == nil {
+		t.Errorf("missing error for missing key")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	c := conf.NewConfig("")
+	c.Add(conf.VtStr, "host", "localhost")
+	c.AddList(conf.VtStr, "hosts", "a")
+	c.Require("host", "hosts", confPort)
+	_, err := c.LogAndValidate()
+	if err == nil || err.Error() != "property required; name=port" {
+		t.Errorf("expected required error; got=%v", err)
+	}
+	c.LogAndValidate()
+	if len(c.Errors) != 1 {
+		t.Errorf("required error reported again; got=%v", c.Errors)
+	}
+}
+
+func TestUnused(t *testing.T) {
+	c := conf.NewConfig("")
+	c.Add(conf.VtStr, "used", "a")
+	c.Add(conf.VtInt, "usedInt", "1")
+	c.Add(conf.VtStr, "dead", "b")
+	c.AddList(conf.VtStr, "deadList", "c")
+	c.Str("used")
+	c.Int("usedInt")
+	unused := fmt.Sprint(c.Unused())
+	if unused != "[dead deadList]" {
+		t.Errorf("unexpected unused; got=%s", unused)
+	}
+}
+
 // todo:
 //func TestDir(t *testing.T) {
 //}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+// fakeKV Stand-in for consul KV api supporting blocking queries.
+type fakeKV struct {
+	mu      sync.Mutex
+	index   uint64
+	kv      map[string]string
+	changed chan struct{}
+	noIndex bool // like a proxy dropping X-Consul-Index
+	calls   int32
+}
+
+func newFakeKV(kv map[string]string) *fakeKV {
+	return &fakeKV{index: 1, kv: kv, changed: make(chan struct{})}
+}
+
+func (f *fakeKV) put(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kv[key] = value
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&f.calls, 1)
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	f.mu.Lock()
+	changed, current := f.changed, f.index
+	f.mu.Unlock()
+	if index > 0 && index == current {
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pairs := []map[string]string{}
+	for k, v := range f.kv {
+		pairs = append(pairs, map[string]string{"Key": k, "Value": base64.StdEncoding.EncodeToString([]byte(v))})
+	}
+	if !f.noIndex {
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	}
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func TestConsulKV(t *testing.T) {
+	prefix := conf.ConsulPrefix("mam-search", "prod")
+	kv := newFakeKV(map[string]string{
+		prefix:                  "",
+		prefix + "port":         "9090",
+		prefix + "db/host":      "db1",
+		prefix + "hosts":        "a\nb",
+		prefix + "log/loglevel": "info",
+	})
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	c := conf.NewConfig("prod")
+	c.Add(conf.VtInt, "port", "8080")
+	c.AddList(conf.VtStr, "hosts", "x")
+	if err := c.LoadConsulKV(srv.Client(), srv.URL, prefix); err != nil {
+		t.Fatalf("failed load; err=%v", err)
+	}
+	if c.Int("port") != 9090 || c.Str("db.host") != "db1" || len(c.StrList("hosts")) != 2 {
+		t.Errorf("unexpected values; values=%v; lists=%v", c.Values, c.Lists)
+	}
+	if _, err := c.LogAndValidate(); err != nil {
+		t.Errorf("unexpected validate error; err=%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 10)
+	go c.WatchConsulKV(ctx, srv.Client(), srv.URL, prefix, []string{"port"}, func(name, value string) {
+		changes <- name + "=" + value
+	})
+	kv.put(prefix+"db/host", "db2") // not watched
+	kv.put(prefix+"port", "bad")    // invalid, ignored
+	kv.put(prefix+"port", "9191")
+	select {
+	case change := <-changes:
+		if change != "port=9191" {
+			t.Errorf("unexpected change; got=%s", change)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no change")
+	}
+	if c.Int("port") != 9191 || c.Str("db.host") != "db1" {
+		t.Errorf("unexpected reload; port=%d; db.host=%s", c.Int("port"), c.Str("db.host"))
+	}
+}
+
+func TestWatchConsulKVWithoutIndex(t *testing.T) {
+	prefix := conf.ConsulPrefix("mam-search", "prod")
+	kv := newFakeKV(map[string]string{prefix + "port": "9090"})
+	kv.noIndex = true
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	c := conf.NewConfig("prod")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	c.WatchConsulKV(ctx, srv.Client(), srv.URL, prefix, []string{"port"}, nil)
+	if calls := atomic.LoadInt32(&kv.calls); calls != 1 {
+		t.Errorf("consul queried without delay; calls=%d", calls)
+	}
+}
+
+func TestConsulKVReloadsReferences(t *testing.T) {
+	prefix := conf.ConsulPrefix("mam-search", "prod")
+	kv := newFakeKV(map[string]string{prefix + "db/host": "db1"})
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	c := conf.NewConfig("prod")
+	c.Add(conf.VtStr, "db.url", "pg://${db.host}/items")
+	c.Add(conf.VtStr, "db.host", "localhost")
+	if err := c.LoadConsulKV(srv.Client(), srv.URL, prefix); err != nil {
+		t.Fatalf("failed load; err=%v", err)
+	}
+	if _, err := c.LogAndValidate(); err != nil || c.Str("db.url") != "pg://db1/items" {
+		t.Fatalf("unexpected value; url=%s; err=%v", c.Str("db.url"), err)
+	}
+
+	changes := make(chan string, 10)
+	c.Subscribe(func(changed []string) { changes <- strings.Join(changed, ",") })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.WatchConsulKV(ctx, srv.Client(), srv.URL, prefix, []string{"db.host"}, nil)
+	kv.put(prefix+"db/host", "db2")
+	select {
+	case change := <-changes:
+		if change != "db.host,db.url" {
+			t.Errorf("unexpected changed keys; got=%s", change)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no change")
+	}
+	if c.Str("db.url") != "pg://db2/items" {
+		t.Errorf("dependent key not resolved again; got=%s", c.Str("db.url"))
+	}
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed write file; err=%v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"svc.conf": `
+# global values
+port = 8080
+name: search
+hosts[] = a
+hosts[] = b
+
+[prod]
+port = 9090
+`,
+		"svc.json": `{
+  "port": 8080,
+  "name": "search",
+  "hosts": ["a", "b"],
+  "profiles": {"prod": {"port": 9090}}
+}`,
+		"svc.yaml": `
+port: 8080
+name: search
+hosts:
+  - a
+  - b
+profiles:
+  prod:
+    port: 9090
+`,
+		"svc.toml": `
+port = 8080 # comment
+name = "search"
+hosts = [
+  "a",
+  "b",
+]
+
+[profiles.prod]
+port = 9_090
+`,
+	}
+	for name, content := range files {
+		c := conf.NewConfig("prod")
+		c.Add(conf.VtInt, "port", "1")
+		if err := c.LoadFile(writeFile(t, dir, name, content)); err != nil {
+			t.Errorf("failed load; file=%s; err=%v", name, err)
+			continue
+		}
+		if _, err := c.LogAndValidate(); err != nil {
+			t.Errorf("unexpected validate error; file=%s; err=%v", name, err)
+		}
+		if c.Int("port") != 9090 || c.Str("name") != "search" || strings.Join(c.StrList("hosts"), ",") != "a,b" {
+			t.Errorf("unexpected values; file=%s; values=%v; lists=%v", name, c.Values, c.Lists)
+		}
+	}
+}
+
+func TestLoadFileLineNumber(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"bad.conf": "name = x\nport = abc\n",
+		"bad.json": "{\n\"name\": \"x\",\n\"port\": \"abc\"\n}",
+		"bad.yaml": "name: x\n\nport: abc\n",
+	} {
+		c := conf.NewConfig("")
+		c.Add(conf.VtInt, "port", "1")
+		path := writeFile(t, dir, name, content)
+		c.LoadFile(path)
+		_, err := c.LogAndValidate()
+		if err == nil {
+			t.Errorf("expected validate error; file=%s", name)
+			continue
+		}
+		line := "2"
+		if name != "bad.conf" {
+			line = "3"
+		}
+		if !strings.Contains(err.Error(), path+":"+line) {
+			t.Errorf("line number missing; file=%s; err=%v", name, err)
+		}
+	}
+}
+
+func TestLoadFileSections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"svc.json": `{
+  "db": {"host": "x", "pool": {"size": 4}},
+  "profiles": {"prod": {"db": {"host": "prod-db"}}, "prod-eu": {"db": {"pool": {"size": 8}}}, "test": {"db": {"host": "test-db"}}}
+}`,
+		"svc.yaml": `
+db:
+  host: x
+  pool:
+    size: 4
+profiles:
+  prod:
+    db:
+      host: prod-db
+  prod-eu:
+    db:
+      pool:
+        size: 8
+  test:
+    db:
+      host: test-db
+`,
+		"svc.toml": `
+[db]
+host = "x"
+pool.size = 4
+
+[profiles.prod.db]
+host = "prod-db"
+
+[profiles.prod-eu]
+db.pool.size = 8
+
+[profiles.test.db]
+host = "test-db"
+`,
+	}
+	for name, content := range files {
+		path := writeFile(t, dir, name, content)
+		c := conf.NewConfig("prod-eu")
+		if err := c.LoadFile(path); err != nil {
+			t.Errorf("failed load; file=%s; err=%v", name, err)
+			continue
+		}
+		if c.Str("db.host") != "prod-db" || c.Str("db.pool.size") != "8" || len(c.Values) != 3 {
+			t.Errorf("unexpected values; file=%s; values=%v", name, c.Values)
+		}
+
+		// same keys whatever the active profile
+		dev := conf.NewConfig("dev")
+		dev.LoadFile(path)
+		if dev.Str("db.host") != "x" || dev.Str("db.pool.size") != "4" || len(dev.Values) != 3 {
+			t.Errorf("unexpected values for dev; file=%s; values=%v", name, dev.Values)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+func TestParseFlags(t *testing.T) {
+	os.Setenv("port", "7070")
+	defer os.Unsetenv("port")
+
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtInt, "port", "8080")
+	c.Add(conf.VtStr, "name", "search")
+	c.Add(conf.VtBool, "debug", "false")
+	c.AddList(conf.VtStr, "hosts", "a")
+
+	rest, err := c.ParseFlags([]string{"--port=9090", "--name", "other", "--debug", "--hosts", "b", "--hosts=c", "file.txt", "--", "--name=x"})
+	if err != nil {
+		t.Fatalf("parse failed; err=%v", err)
+	}
+	if c.Str("port") != "9090" || c.Str("name") != "other" || c.Str("debug") != "true" {
+		t.Errorf("unexpected values; port=%s; name=%s; debug=%s", c.Str("port"), c.Str("name"), c.Str("debug"))
+	}
+	if got := strings.Join(c.StrList("hosts"), ","); got != "b,c" {
+		t.Errorf("unexpected list; got=%s", got)
+	}
+	if got := strings.Join(rest, " "); got != "file.txt --name=x" {
+		t.Errorf("unexpected rest; got=%s", got)
+	}
+	if origin, _ := c.Origin("port"); origin.String() != "flag --port" {
+		t.Errorf("unexpected origin; got=%s", origin)
+	}
+
+	c.Add(conf.VtInt, "port", "1")
+	if c.Str("port") != "9090" {
+		t.Errorf("flag overridden; got=%s", c.Str("port"))
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtInt, "port", "8080")
+	if _, err := c.ParseFlags([]string{"--prot=1", "--port=x", "--port"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(c.Errors) != 3 {
+		t.Errorf("expected 3 errors; got=%v", c.Errors)
+	}
+	if _, err := c.ParseFlags([]string{"--help"}); err != flag.ErrHelp {
+		t.Errorf("expected ErrHelp; got=%v", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.SetEnvPrefix("MYSVC")
+	c.SetEnum("db.level", "debug", "info")
+	c.Add(conf.VtInt, "db.maxConns", "10")
+	c.Add(conf.VtSecret, "db.pass", "s3cr3t")
+	c.Add(conf.VtEnum, "db.level", "info")
+	c.AddList(conf.VtStr, "hosts", "a")
+	buf := &bytes.Buffer{}
+	c.Usage(buf)
+	for _, expected := range []string{
+		"--db.maxConns int\n    \tenv MYSVC_DB_MAX_CONNS; value 10\n",
+		"--db.pass secret\n    \tenv MYSVC_DB_PASS; value ***\n",
+		"--db.level enum\n    \tenv MYSVC_DB_LEVEL; value info; one of debug|info\n",
+		"--hosts list of str\n    \tenv MYSVC_HOSTS; value a\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("usage missing %q; got=%s", expected, buf.String())
+		}
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	os.Setenv("MYSVC_MY_KEY", "env")
+	os.Setenv("my.key", "raw")
+	defer os.Unsetenv("MYSVC_MY_KEY")
+	defer os.Unsetenv("my.key")
+
+	c := conf.NewConfig("dev")
+	c.SetEnvPrefix("MYSVC_")
+	c.Add(conf.VtStr, "my.key", "default")
+	if c.Str("my.key") != "env" || c.EnvName("my.key") != "MYSVC_MY_KEY" {
+		t.Errorf("prefixed env not used; got=%s", c.Str("my.key"))
+	}
+
+	c = conf.NewConfig("dev")
+	c.Add(conf.VtStr, "my.key", "default")
+	if c.Str("my.key") != "raw" {
+		t.Errorf("raw env not used without prefix; got=%s", c.Str("my.key"))
+	}
+}
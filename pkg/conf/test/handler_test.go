@@ -0,0 +1,65 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+func TestHandler(t *testing.T) {
+	c := conf.NewConfig("prod")
+	c.AddProfile(conf.VtInt, "prod", "port", "8080")
+	c.Add(conf.VtStr, "db.password", "s3cr3t")
+	c.Add(conf.VtSecret, "apiKeys", "s3cr3t")
+	c.AddList(conf.VtStr, "tokens", "s3cr3t")
+	c.AddList(conf.VtStr, "hosts", "a")
+	c.Add(conf.VtInt, "bad", "x")
+
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	if w.Header().Get("Content-Type") != "application/json; charset=UTF-8" {
+		t.Errorf("unexpected content type; got=%s", w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "s3cr3t") {
+		t.Errorf("secret in dump; body=%s", body)
+	}
+
+	var d conf.Dump
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	port := d.Values["port"]
+	if d.Profile != "prod" || port.Value != "8080" || port.Type != "int" || port.Source != "default" || port.Profile != "prod" {
+		t.Errorf("unexpected dump; profile=%s; port=%+v", d.Profile, port)
+	}
+	if d.Values["apiKeys"].Value != "***" || d.Lists["tokens"].Values[0] != "***" || d.Lists["hosts"].Values[0] != "a" {
+		t.Errorf("unexpected redaction; values=%+v; lists=%+v", d.Values, d.Lists)
+	}
+	if len(d.Errors) != 1 || !strings.Contains(d.Errors[0], "name=bad") {
+		t.Errorf("unexpected errors; got=%v", d.Errors)
+	}
+}
+
+func TestDumpWhileAddingErrors(t *testing.T) {
+	c := conf.NewConfig("")
+	c.Add(conf.VtStr, "url", "${missing}")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.Add(conf.VtInt, "port", "x")
+			c.Interpolate()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		c.Dump()
+	}
+	<-done
+	if len(c.ErrorList()) != 101 {
+		t.Errorf("unexpected number of errors; got=%d", len(c.ErrorList()))
+	}
+}
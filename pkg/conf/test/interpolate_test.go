@@ -0,0 +1,142 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("CONF_TEST_ROOT", "/mnt/media")
+	defer os.Unsetenv("CONF_TEST_ROOT")
+
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtStr, "storage.root", "${env:CONF_TEST_ROOT:-/data}")
+	c.Add(conf.VtStr, "storage.house", "${storage.root}/house")
+	c.Add(conf.VtStr, "storage.tmp", "${storage.house}/tmp-${env:CONF_TEST_UNSET:-1}")
+	c.Add(conf.VtInt, "port", "${base.port}")
+	c.Add(conf.VtStr, "base.port", "80${env:CONF_TEST_UNSET:-80}")
+	c.AddList(conf.VtStr, "dirs", "${storage.root}/a")
+	c.AddList(conf.VtStr, "dirs", "plain")
+	if _, err := c.LogAndValidate(); err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+
+	expected := map[string]string{
+		"storage.root":  "/mnt/media",
+		"storage.house": "/mnt/media/house",
+		"storage.tmp":   "/mnt/media/house/tmp-1",
+		"port":          "8080",
+	}
+	for name, value := range expected {
+		if got := c.Str(name); got != value {
+			t.Errorf("unexpected value; name=%s; expected=%s; got=%s", name, value, got)
+		}
+	}
+	if got := strings.Join(c.StrList("dirs"), ","); got != "/mnt/media/a,plain" {
+		t.Errorf("unexpected list; got=%s", got)
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtStr, "a", "${b}")
+	c.Add(conf.VtStr, "b", "x${a}")
+	c.Add(conf.VtStr, "missing", "${nope}")
+	c.Add(conf.VtInt, "port", "${name}")
+	c.Add(conf.VtStr, "name", "search")
+	c.Add(conf.VtStr, "open", "${name")
+	if _, err := c.LogAndValidate(); err == nil {
+		t.Fatal("expected error")
+	}
+	errs := []string{}
+	for _, err := range c.Errors {
+		errs = append(errs, err.Error())
+	}
+	all := strings.Join(errs, "\n")
+	for _, expected := range []string{
+		"interpolation cycle; path=a -> b -> a",
+		"name=missing; interpolation key missing; ref=nope",
+		"propery value invalid; name=port; value=search",
+		"name=open; interpolation not terminated",
+	} {
+		if !strings.Contains(all, expected) {
+			t.Errorf("missing error %q; got=%s", expected, all)
+		}
+	}
+
+	// errors are reported once
+	count := len(c.Errors)
+	c.LogAndValidate()
+	if len(c.Errors) != count {
+		t.Errorf("errors reported again; got=%v", c.Errors[count:])
+	}
+}
+
+func TestInterpolateRedactsReferences(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtStr, "db.password", "s3cr3t")
+	c.Add(conf.VtSecret, "db.login", "pg-login")
+	c.Add(conf.VtStr, "db.url", "postgres://u:${db.password}@h")
+	c.Add(conf.VtStr, "db.conn", "${db.base}?user=${db.login}")
+	c.Add(conf.VtStr, "db.base", "pg")
+	c.Add(conf.VtStr, "db.host", "${db.hostName}")
+	c.Add(conf.VtStr, "db.hostName", "h")
+
+	buf, restore := captureLog()
+	defer restore()
+	if _, err := c.LogAndValidate(); err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	if c.Str("db.url") != "postgres://u:s3cr3t@h" || c.Str("db.conn") != "pg?user=pg-login" {
+		t.Errorf("unexpected values; url=%s; conn=%s", c.Str("db.url"), c.Str("db.conn"))
+	}
+	if strings.Contains(buf.String(), "s3cr3t") || strings.Contains(buf.String(), "pg-login") {
+		t.Errorf("secret referenced by other key logged; log=%s", buf.String())
+	}
+	d := c.Dump()
+	if d.Values["db.url"].Value != "***" || d.Values["db.conn"].Value != "***" || d.Values["db.host"].Value != "h" {
+		t.Errorf("unexpected redaction; values=%+v", d.Values)
+	}
+}
+
+func TestInterpolateLiteral(t *testing.T) {
+	os.Setenv("conf.test.secret", "ab${cd}ef")
+	defer os.Unsetenv("conf.test.secret")
+	path := writeFile(t, t.TempDir(), "login", "pg${login}\n")
+	os.Setenv("db.login_FILE", path)
+	defer os.Unsetenv("db.login_FILE")
+
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtSecret, "conf.test.secret", "")
+	c.Add(conf.VtStr, "db.login", "")
+	c.Add(conf.VtStr, "db.conn", "${db.login}:${conf.test.secret}")
+	c.Add(conf.VtStr, "template", "$${name}-${env:CONF_TEST_UNSET:-x}")
+	c.Add(conf.VtStr, "api.token", "t${cd}")
+	buf, restore := captureLog()
+	defer restore()
+	c.LogAndValidate()
+
+	if len(c.Errors) != 1 {
+		t.Fatalf("expected only error for api.token; got=%v", c.Errors)
+	}
+	if err := c.Errors[0].Error(); strings.Contains(err, "cd") || !strings.Contains(err, "name=api.token") {
+		t.Errorf("secret in interpolation error; err=%s", err)
+	}
+	expected := map[string]string{
+		"conf.test.secret": "ab${cd}ef",
+		"db.login":         "pg${login}",
+		"db.conn":          "pg${login}:ab${cd}ef",
+		"template":         "${name}-x",
+	}
+	for name, value := range expected {
+		if got := c.Str(name); got != value {
+			t.Errorf("unexpected value; name=%s; expected=%s; got=%s", name, value, got)
+		}
+	}
+	if strings.Contains(buf.String(), "cd}") {
+		t.Errorf("secret logged; log=%s", buf.String())
+	}
+}
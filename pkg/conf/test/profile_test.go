@@ -0,0 +1,83 @@
+package test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+func TestProfileChain(t *testing.T) {
+	c := conf.NewConfig("prod-eu")
+	if got := fmt.Sprintf("%q", c.ProfileChain()); got != `["prod-eu" "prod" ""]` {
+		t.Errorf("unexpected chain; got=%s", got)
+	}
+	c.AddProfile(conf.VtStr, "prod-eu", "region", "eu")
+	c.AddProfile(conf.VtStr, "", "region", "none")
+	c.AddProfile(conf.VtStr, "prod", "region", "prod")
+	c.AddProfile(conf.VtStr, "prod", "db", "pg-prod")
+	c.AddProfile(conf.VtStr, "dev", "db", "pg-dev")
+	if c.Str("region") != "eu" || c.Str("db") != "pg-prod" {
+		t.Errorf("unexpected values; region=%s; db=%s", c.Str("region"), c.Str("db"))
+	}
+
+	// AddStrProfile follows the chain and env override
+	os.Setenv("conf.test.queue", "env-queue")
+	defer os.Unsetenv("conf.test.queue")
+	c.AddStrProfile("prod", "cache", "redis-prod")
+	c.AddStrProfile("dev", "cache", "redis-dev")
+	c.AddStrProfile("prod", "conf.test.queue", "queue-prod")
+	if c.Str("cache") != "redis-prod" || c.Str("conf.test.queue") != "env-queue" {
+		t.Errorf("unexpected str profile values; cache=%s; queue=%s", c.Str("cache"), c.Str("conf.test.queue"))
+	}
+
+	c = conf.NewConfig("eu-prod")
+	c.Inherit("prod")
+	c.AddProfile(conf.VtStr, "prod", "db", "pg-prod")
+	c.AddProfile(conf.VtStr, "eu", "db", "pg-eu")
+	if c.Str("db") != "pg-prod" {
+		t.Errorf("inherited value missing; got=%s", c.Str("db"))
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "svc.conf", "port = 8080\nname = file\nhosts[] = a\n")
+	os.Setenv("conf.test.user", "env")
+	defer os.Unsetenv("conf.test.user")
+
+	c := conf.NewConfig("prod")
+	c.LoadFile(path)
+	// defaults added after the file do not override it
+	c.AddProfile(conf.VtInt, "prod", "port", "1")
+	c.Add(conf.VtStr, "name", "default")
+	c.AddList(conf.VtStr, "hosts", "b")
+	c.Add(conf.VtStr, "conf.test.user", "default")
+	c.Add(conf.VtStr, "timeout", "5s")
+
+	if c.Str("port") != "8080" || c.Str("name") != "file" || strings.Join(c.StrList("hosts"), ",") != "a" {
+		t.Errorf("default overrode file; port=%s; name=%s; hosts=%v", c.Str("port"), c.Str("name"), c.StrList("hosts"))
+	}
+	expected := map[string]string{
+		"port":           "file " + path + ":1",
+		"hosts":          "file " + path + ":3",
+		"conf.test.user": "env conf.test.user",
+		"timeout":        "default",
+	}
+	for name, origin := range expected {
+		got, ok := c.Origin(name)
+		if !ok || got.String() != origin {
+			t.Errorf("unexpected origin; name=%s; expected=%s; got=%s", name, origin, got)
+		}
+	}
+	if _, ok := c.Origin("missing"); ok {
+		t.Error("missing key should have no origin")
+	}
+}
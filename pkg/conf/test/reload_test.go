@@ -0,0 +1,201 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "svc.conf", "port = 8080\nname = search\nhosts[] = a\n")
+
+	c, err := conf.Load("dev", func(c *conf.Config) {
+		c.Add(conf.VtInt, "port", "1")
+		c.Require("name")
+		c.LoadFile(path)
+	})
+	if err != nil {
+		t.Fatalf("load failed; err=%v", err)
+	}
+	changes := make(chan []string, 10)
+	c.Subscribe(func(changed []string) { changes <- changed })
+
+	writeFile(t, dir, "svc.conf", "port = 9090\nname = search\nhosts[] = a\nhosts[] = b\n")
+	if err := c.Reload(); err != nil {
+		t.Fatalf("reload failed; err=%v", err)
+	}
+	if got := fmt.Sprint(<-changes); got != "[hosts port]" {
+		t.Errorf("unexpected changed keys; got=%s", got)
+	}
+	if c.Int("port") != 9090 || len(c.StrList("hosts")) != 2 {
+		t.Errorf("values not reloaded; port=%d; hosts=%v", c.Int("port"), c.StrList("hosts"))
+	}
+
+	// invalid snapshot keeps current values
+	writeFile(t, dir, "svc.conf", "port = ninety\n")
+	if err := c.Reload(); err == nil {
+		t.Error("expected reload error")
+	}
+	if c.Int("port") != 9090 || c.Str("name") != "search" {
+		t.Errorf("values changed by failed reload; port=%d; name=%s", c.Int("port"), c.Str("name"))
+	}
+	if len(changes) != 0 {
+		t.Errorf("subscriber notified of failed reload")
+	}
+}
+
+func TestReloadKeepsFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "svc.conf", "port = 8080\nname = search\n")
+
+	c, err := conf.Load("dev", func(c *conf.Config) {
+		c.Add(conf.VtInt, "port", "1")
+		c.LoadFile(path)
+	})
+	if err != nil {
+		t.Fatalf("load failed; err=%v", err)
+	}
+	if _, err := c.ParseFlags([]string{"--port=7070"}); err != nil {
+		t.Fatalf("parse flags failed; err=%v", err)
+	}
+
+	writeFile(t, dir, "svc.conf", "port = 9090\nname = other\n")
+	if err := c.Reload(); err != nil {
+		t.Fatalf("reload failed; err=%v", err)
+	}
+	if c.Int("port") != 7070 || c.Str("name") != "other" {
+		t.Errorf("flag lost on reload; port=%d; name=%s", c.Int("port"), c.Str("name"))
+	}
+}
+
+func TestReloadFlagsInLoader(t *testing.T) {
+	c, err := conf.Load("dev", func(c *conf.Config) {
+		c.AddList(conf.VtStr, "hosts", "a")
+		c.ParseFlags([]string{"--hosts=b"})
+	})
+	if err != nil {
+		t.Fatalf("load failed; err=%v", err)
+	}
+	if err := c.Reload(); err != nil {
+		t.Fatalf("reload failed; err=%v", err)
+	}
+	if got := strings.Join(c.StrList("hosts"), ","); got != "b" {
+		t.Errorf("flags applied twice; got=%s", got)
+	}
+	c.ParseFlags([]string{"--hosts=c"})
+	if got := strings.Join(c.StrList("hosts"), ","); got != "c" {
+		t.Errorf("list flag not replaced; got=%s", got)
+	}
+}
+
+func TestReloadKeepsSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "svc.conf", "a = 1\nlevel = info\n")
+
+	c, err := conf.Load("dev", func(c *conf.Config) { c.LoadFile(path) })
+	if err != nil {
+		t.Fatalf("load failed; err=%v", err)
+	}
+	var s struct {
+		Timeout time.Duration `conf:"timeout,default=2s"`
+		Level   string        `conf:"level,type=enum,values=info|warn"`
+	}
+	if err := c.Bind(&s); err != nil {
+		t.Fatalf("bind failed; err=%v", err)
+	}
+	c.Require("a")
+
+	// bind default is added again
+	if err := c.Reload(); err != nil {
+		t.Fatalf("reload failed; err=%v", err)
+	}
+	if c.Str("timeout") != "2s" {
+		t.Errorf("bind default lost on reload; got=%s", c.Str("timeout"))
+	}
+
+	// enum bound after Load is checked
+	writeFile(t, dir, "svc.conf", "a = 1\nlevel = trace\n")
+	if err := c.Reload(); err == nil {
+		t.Error("expected error for value not in enum")
+	}
+
+	// key required after Load is checked
+	writeFile(t, dir, "svc.conf", "level = warn\n")
+	if err := c.Reload(); err == nil {
+		t.Error("expected error for missing required key")
+	}
+	if c.Str("a") != "1" || c.Str("level") != "info" {
+		t.Errorf("values changed by failed reload; a=%s; level=%s", c.Str("a"), c.Str("level"))
+	}
+}
+
+func TestReloadNotLoaded(t *testing.T) {
+	if err := conf.NewConfig("dev").Reload(); err == nil {
+		t.Error("expected error reloading config without loader")
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeFile(t, dir, "svc.conf", "port = 8080\n")
+
+	c, err := conf.Load("dev", func(c *conf.Config) { c.LoadFile(path) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan []string, 10)
+	c.Subscribe(func(changed []string) { changes <- changed })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.WatchFiles(ctx, 10*time.Millisecond)
+	c.ReloadOnSignal(ctx)
+
+	time.Sleep(20 * time.Millisecond)
+	writeFile(t, dir, "svc.conf", "port = 9090\n")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(path, future, future)
+	select {
+	case changed := <-changes:
+		if fmt.Sprint(changed) != "[port]" || c.Str("port") != "9090" {
+			t.Errorf("unexpected reload; changed=%v; port=%s", changed, c.Str("port"))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("file change not reloaded")
+	}
+
+	writeFile(t, dir, "svc.conf", "port = 7070\n")
+	os.Chtimes(path, future, future) // unchanged time, only SIGHUP reloads
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	select {
+	case <-changes:
+		if c.Str("port") != "7070" {
+			t.Errorf("unexpected port; got=%s", c.Str("port"))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("SIGHUP not reloaded")
+	}
+}
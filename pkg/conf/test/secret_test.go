@@ -0,0 +1,99 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func captureLog() (*bytes.Buffer, func()) {
+	buf := &bytes.Buffer{}
+	old := log.Logger
+	log.Logger = zerolog.New(buf)
+	return buf, func() { log.Logger = old }
+}
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, "db.pass", "s3cr3t-dir\n")
+	writeFile(t, dir, ".hidden", "skip")
+	tokenFile := writeFile(t, t.TempDir(), "token", "s3cr3t-file\n")
+	os.Setenv("conf.test.apikey_FILE", writeFile(t, t.TempDir(), "apikey", "s3cr3t-env"))
+	defer os.Unsetenv("conf.test.apikey_FILE")
+
+	buf, restore := captureLog()
+	defer restore()
+
+	c := conf.NewConfig("dev")
+	c.Redact = append(c.Redact, "conn")
+	c.Add(conf.VtSecret, "plain", "s3cr3t-value")
+	c.Add(conf.VtStr, "db.conn", "s3cr3t-pattern")
+	c.Add(conf.VtStr, "conf.test.apikey", "")
+	c.AddSecretFile("", "token", tokenFile)
+	c.AddSecretFile("prod", "inactive", "/does/not/exist")
+	if err := c.LoadSecretDir("", dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.LogAndValidate(); err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+
+	expected := map[string]string{
+		"plain":            "s3cr3t-value",
+		"db.conn":          "s3cr3t-pattern",
+		"conf.test.apikey": "s3cr3t-env",
+		"token":            "s3cr3t-file",
+		"db.pass":          "s3cr3t-dir",
+	}
+	for name, value := range expected {
+		if got := c.Str(name); got != value {
+			t.Errorf("unexpected value; name=%s; expected=%s; got=%s", name, value, got)
+		}
+	}
+	if _, ok := c.Lookup(".hidden"); ok {
+		t.Error("hidden file should be skipped")
+	}
+	if strings.Contains(buf.String(), "s3cr3t") {
+		t.Errorf("secret logged; log=%s", buf.String())
+	}
+}
+
+func TestSecretFileMissing(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.AddSecretFile("", "token", "/does/not/exist")
+	if len(c.Errors) != 1 {
+		t.Errorf("expected error; got=%v", c.Errors)
+	}
+}
+
+func TestErrorsRedacted(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtInt, "api.token", "abc123")
+	c.Add(conf.VtStr, "db.password", "s3cr3t")
+	c.Add(conf.VtInt, "port", "eighty")
+	var s struct {
+		Pass int `conf:"db.password"`
+	}
+	c.Bind(&s)
+	if _, err := c.IntE("db.password"); err == nil || strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("expected redacted error; err=%v", err)
+	}
+
+	errs := strings.Join(c.Dump().Errors, "\n")
+	if strings.Contains(errs, "abc123") || strings.Contains(errs, "s3cr3t") {
+		t.Errorf("secret in errors; got=%s", errs)
+	}
+	if !strings.Contains(errs, "name=api.token; value=***") || !strings.Contains(errs, "value=eighty") {
+		t.Errorf("unexpected errors; got=%s", errs)
+	}
+}
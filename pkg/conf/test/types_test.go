@@ -0,0 +1,138 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/conf"
+)
+
+func TestTypedValues(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.SetEnum("level", "debug", "info", "warn")
+	c.Add(conf.VtBool, "enabled", "true")
+	c.Add(conf.VtFloat, "ratio", "0.25")
+	c.Add(conf.VtDuration, "timeout", "1m30s")
+	c.Add(conf.VtURL, "api", "https://api.example.com/v1")
+	c.Add(conf.VtHostPort, "listen", ":8080")
+	c.Add(conf.VtEnum, "level", "info")
+	c.Add(conf.VtRegexp, "match", "^item-[0-9]+$")
+	c.Add(conf.VtByteSize, "maxBody", "10MiB")
+	if len(c.Errors) > 0 {
+		t.Fatalf("unexpected errors; got=%v", c.Errors)
+	}
+
+	if b, err := c.Bool("enabled"); err != nil || !b {
+		t.Errorf("bad bool; got=%v; err=%v", b, err)
+	}
+	if f, err := c.Float("ratio"); err != nil || f != 0.25 {
+		t.Errorf("bad float; got=%v; err=%v", f, err)
+	}
+	if d, err := c.Duration("timeout"); err != nil || d != 90*time.Second {
+		t.Errorf("bad duration; got=%v; err=%v", d, err)
+	}
+	if u, err := c.URL("api"); err != nil || u.Host != "api.example.com" {
+		t.Errorf("bad url; got=%v; err=%v", u, err)
+	}
+	if s, err := c.HostPort("listen"); err != nil || s != ":8080" {
+		t.Errorf("bad hostport; got=%v; err=%v", s, err)
+	}
+	if s, err := c.Enum("level"); err != nil || s != "info" {
+		t.Errorf("bad enum; got=%v; err=%v", s, err)
+	}
+	if re, err := c.Regexp("match"); err != nil || !re.MatchString("item-12") {
+		t.Errorf("bad regexp; got=%v; err=%v", re, err)
+	}
+	if n, err := c.ByteSize("maxBody"); err != nil || n != 10<<20 {
+		t.Errorf("bad byte size; got=%v; err=%v", n, err)
+	}
+
+	if _, err := c.Bool("missing"); err == nil {
+		t.Error("expected error for missing key")
+	}
+	if c.DurationOr("missing", time.Second) != time.Second || c.IntOr("ratio", 7) != 7 || !c.BoolOr("enabled", false) {
+		t.Error("bad default getters")
+	}
+}
+
+func TestInvalidTypedValues(t *testing.T) {
+	c := conf.NewConfig("dev")
+	c.SetEnum("level", "debug", "info")
+	c.Add(conf.VtBool, "enabled", "maybe")
+	c.Add(conf.VtFloat, "ratio", "quarter")
+	c.Add(conf.VtDuration, "timeout", "90")
+	c.Add(conf.VtURL, "api", "api.example.com")
+	c.Add(conf.VtHostPort, "listen", "localhost:http")
+	c.Add(conf.VtEnum, "level", "trace")
+	c.Add(conf.VtRegexp, "match", "item-[")
+	c.Add(conf.VtByteSize, "maxBody", "10XB")
+	if len(c.Errors) != 8 {
+		t.Fatalf("expected 8 errors; got=%v", c.Errors)
+	}
+	if !strings.Contains(c.Errors[5].Error(), "allowed=debug|info") {
+		t.Errorf("enum error should list allowed values; got=%v", c.Errors[5])
+	}
+}
+
+func TestIntE(t *testing.T) {
+	c := conf.NewConfig("")
+	c.Add(conf.VtStr, "port", "8080")
+	c.Add(conf.VtStr, "name", "search")
+	if n, err := c.IntE("port"); err != nil || n != 8080 {
+		t.Errorf("unexpected int; got=%d; err=%v", n, err)
+	}
+	if _, err := c.IntE("name"); err == nil || !strings.Contains(err.Error(), "name=name") {
+		t.Errorf("expected invalid error; err=%v", err)
+	}
+	if _, err := c.IntE("missing"); err == nil {
+		t.Errorf("expected missing error")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":    512,
+		"10KB":   10000,
+		"10kb":   10000,
+		"1.5GiB": 3 << 29,
+		"64M":    64 << 20,
+		"2 TB":   2e12,
+	}
+	for s, expected := range tests {
+		n, err := conf.ParseByteSize(s)
+		if err != nil || n != expected {
+			t.Errorf("bad size; value=%s; expected=%d; got=%d; err=%v", s, expected, n, err)
+		}
+	}
+	for _, s := range []string{"", "KB", "-1", "10 parsecs"} {
+		if _, err := conf.ParseByteSize(s); err == nil {
+			t.Errorf("expected error; value=%s", s)
+		}
+	}
+}
+
+func TestBindTypes(t *testing.T) {
+	type s struct {
+		Level   string        `conf:"level,type=enum,values=debug|info,default=info"`
+		MaxBody int64         `conf:"maxBody,type=bytesize,default=1MB"`
+		Debug   bool          `conf:"debug,default=false"`
+		Ratio   float64       `conf:"ratio,default=0.5"`
+		Every   time.Duration `conf:"every,default=1h"`
+	}
+	c := conf.NewConfig("dev")
+	c.Add(conf.VtStr, "level", "debug")
+	var v s
+	if err := c.Bind(&v); err != nil {
+		t.Fatalf("bind failed; err=%v", err)
+	}
+	if v.Level != "debug" || v.MaxBody != 1e6 || v.Debug || v.Ratio != 0.5 || v.Every != time.Hour {
+		t.Errorf("bad values; got=%+v", v)
+	}
+
+	c = conf.NewConfig("dev")
+	c.Add(conf.VtStr, "level", "trace")
+	if err := c.Bind(&v); err == nil || !strings.Contains(err.Error(), "allowed=debug|info") {
+		t.Errorf("expected enum error; got=%v", err)
+	}
+}
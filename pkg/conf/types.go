@@ -0,0 +1,384 @@
+package conf
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SetEnum Set allowed values of an VtEnum key. Must be called before values are added.
+func (c *Config) SetEnum(name string, allowed ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enums[name] = allowed
+}
+
+func (c *Config) enumValues(name string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.enums[name]
+}
+
+// checkEnum Returns error if value is not one of the allowed values of name.
+func (c *Config) checkEnum(name, value string) error {
+	allowed := c.enumValues(name)
+	for _, v := range allowed {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("%v; allowed=%s", c.valueErr("propery value not allowed", name, value, nil), strings.Join(allowed, "|"))
+}
+
+// parseValue Returns error if value can not be parsed as type t.
+func parseValue(t ValueType, value string) error {
+	var err error
+	switch t {
+	case VtBool:
+		_, err = strconv.ParseBool(value)
+	case VtFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case VtDuration:
+		_, err = time.ParseDuration(value)
+	case VtURL:
+		_, err = parseURL(value)
+	case VtHostPort:
+		_, err = parseHostPort(value)
+	case VtRegexp:
+		_, err = regexp.Compile(value)
+	case VtByteSize:
+		_, err = ParseByteSize(value)
+	}
+	return err
+}
+
+func parseURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("url scheme missing; url=%s", value)
+	}
+	return u, nil
+}
+
+// parseHostPort Accepts host:port and :port with numeric port.
+func parseHostPort(value string) (string, error) {
+	_, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("bad port; value=%s", value)
+	}
+	return value, nil
+}
+
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"k":   1 << 10,
+	"m":   1 << 20,
+	"g":   1 << 30,
+	"t":   1 << 40,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseByteSize Parse a size like 512, 10KB, 1.5GiB or 64M. KB, MB, GB and TB are powers of 1000,
+// KiB, MiB, GiB, TiB and the short forms K, M, G and T are powers of 1024. Units are case insensitive.
+func ParseByteSize(value string) (int64, error) {
+	s := strings.TrimSpace(value)
+	index := strings.IndexFunc(s, func(r rune) bool { return unicode.IsLetter(r) })
+	if index < 0 {
+		index = len(s)
+	}
+	number, unit := strings.TrimSpace(s[:index]), strings.ToLower(s[index:])
+	multiplier, isFound := byteUnits[unit]
+	if !isFound {
+		return 0, fmt.Errorf("unknown byte size unit; value=%s", value)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad byte size; value=%s", value)
+	}
+	size := n * multiplier
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("byte size too large; value=%s", value)
+	}
+	return int64(size), nil
+}
+
+// get Returns value of name or error if it is missing.
+func (c *Config) get(name string) (string, error) {
+	value, isFound := c.Lookup(name)
+	if !isFound {
+		return "", fmt.Errorf("property missing; name=%s", name)
+	}
+	return value, nil
+}
+
+func logInvalid(name string, err error) {
+	log.Error().Err(err).Str("name", name).Msg("property invalid, using default")
+}
+
+func (c *Config) invalid(name, value string, err error) error {
+	return c.valueErr("propery value invalid", name, value, err)
+}
+
+// valueErr Returns error for value of name, redacted like logNameValue. Parse errors may repeat the
+// value, so err is left out for secret keys.
+func (c *Config) valueErr(msg, name, value string, err error) error {
+	if c.isSecret(name, make(map[string]bool)) {
+		return fmt.Errorf("%s; name=%s; value=%s", msg, name, redacted)
+	}
+	if err == nil {
+		return fmt.Errorf("%s; name=%s; value=%s", msg, name, value)
+	}
+	return fmt.Errorf("%s; name=%s; value=%s; %v", msg, name, value, err)
+}
+
+// IntE Returns int value of name, or an error if missing or not numeric.
+func (c *Config) IntE(name string) (int64, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, c.invalid(name, s, err)
+	}
+	return n, nil
+}
+
+// IntOr Returns int value of name, or def if missing or invalid.
+func (c *Config) IntOr(name string, def int64) int64 {
+	s, ok := c.Lookup(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		logInvalid(name, c.invalid(name, s, err))
+		return def
+	}
+	return n
+}
+
+func (c *Config) Bool(name string) (bool, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, c.invalid(name, s, err)
+	}
+	return b, nil
+}
+
+// BoolOr Returns bool value of name, or def if missing or invalid.
+func (c *Config) BoolOr(name string, def bool) bool {
+	if _, ok := c.lookup(name); !ok {
+		return def
+	}
+	b, err := c.Bool(name)
+	if err != nil {
+		logInvalid(name, err)
+		return def
+	}
+	return b
+}
+
+func (c *Config) Float(name string) (float64, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, c.invalid(name, s, err)
+	}
+	return f, nil
+}
+
+// FloatOr Returns float value of name, or def if missing or invalid.
+func (c *Config) FloatOr(name string, def float64) float64 {
+	if _, ok := c.lookup(name); !ok {
+		return def
+	}
+	f, err := c.Float(name)
+	if err != nil {
+		logInvalid(name, err)
+		return def
+	}
+	return f
+}
+
+// Duration Returns value like 1.5s or 2m30s.
+func (c *Config) Duration(name string) (time.Duration, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, c.invalid(name, s, err)
+	}
+	return d, nil
+}
+
+// DurationOr Returns duration value of name, or def if missing or invalid.
+func (c *Config) DurationOr(name string, def time.Duration) time.Duration {
+	if _, ok := c.lookup(name); !ok {
+		return def
+	}
+	d, err := c.Duration(name)
+	if err != nil {
+		logInvalid(name, err)
+		return def
+	}
+	return d
+}
+
+// URL Returns value as absolute url.
+func (c *Config) URL(name string) (*url.URL, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return nil, err
+	}
+	u, err := parseURL(s)
+	if err != nil {
+		return nil, c.invalid(name, s, err)
+	}
+	return u, nil
+}
+
+// URLOr Returns url value of name, or def parsed if missing or invalid.
+func (c *Config) URLOr(name, def string) *url.URL {
+	if _, ok := c.lookup(name); ok {
+		u, err := c.URL(name)
+		if err == nil {
+			return u
+		}
+		logInvalid(name, err)
+	}
+	u, _ := url.Parse(def)
+	return u
+}
+
+// HostPort Returns value like localhost:8080 or :8080.
+func (c *Config) HostPort(name string) (string, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := parseHostPort(s); err != nil {
+		return "", c.invalid(name, s, err)
+	}
+	return s, nil
+}
+
+// HostPortOr Returns host:port value of name, or def if missing or invalid.
+func (c *Config) HostPortOr(name, def string) string {
+	if _, ok := c.lookup(name); !ok {
+		return def
+	}
+	s, err := c.HostPort(name)
+	if err != nil {
+		logInvalid(name, err)
+		return def
+	}
+	return s
+}
+
+// Enum Returns value of name if it is one of the values given to SetEnum.
+func (c *Config) Enum(name string) (string, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return "", err
+	}
+	if err := c.checkEnum(name, s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// EnumOr Returns enum value of name, or def if missing or not allowed.
+func (c *Config) EnumOr(name, def string) string {
+	if _, ok := c.lookup(name); !ok {
+		return def
+	}
+	s, err := c.Enum(name)
+	if err != nil {
+		logInvalid(name, err)
+		return def
+	}
+	return s
+}
+
+func (c *Config) Regexp(name string) (*regexp.Regexp, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, c.invalid(name, s, err)
+	}
+	return re, nil
+}
+
+// RegexpOr Returns compiled value of name, or def compiled if missing or invalid. Panics if def is invalid.
+func (c *Config) RegexpOr(name, def string) *regexp.Regexp {
+	if _, ok := c.lookup(name); ok {
+		re, err := c.Regexp(name)
+		if err == nil {
+			return re
+		}
+		logInvalid(name, err)
+	}
+	return regexp.MustCompile(def)
+}
+
+// ByteSize Returns value like 10MB in bytes. See ParseByteSize.
+func (c *Config) ByteSize(name string) (int64, error) {
+	s, err := c.get(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := ParseByteSize(s)
+	if err != nil {
+		return 0, c.invalid(name, s, err)
+	}
+	return n, nil
+}
+
+// ByteSizeOr Returns byte size of name, or def if missing or invalid.
+func (c *Config) ByteSizeOr(name string, def int64) int64 {
+	if _, ok := c.lookup(name); !ok {
+		return def
+	}
+	n, err := c.ByteSize(name)
+	if err != nil {
+		logInvalid(name, err)
+		return def
+	}
+	return n
+}
@@ -1,9 +1,11 @@
 package myconsul
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -16,35 +18,86 @@ type ServiceAddress struct {
 }
 
 type consulService struct {
-	Service string `json:"Service"`
-	Address string `json:"Address"`
-	Port    int    `json:"Port"`
+	ID         string            `json:"ID"`
+	Service    string            `json:"Service"`
+	Address    string            `json:"Address"`
+	Port       int               `json:"Port"`
+	Tags       []string          `json:"Tags"`
+	Meta       map[string]string `json:"Meta"`
+	Datacenter string            `json:"Datacenter"`
 }
 
+// ListServices Returns one instance per service name. Use ListInstances to get all instances.
 func ListServices(client *http.Client, consulAddress string) (map[string]ServiceAddress, error) {
+	instances, _, err := fetchServices(context.Background(), client, consulAddress, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return toServiceAddresses(instances), nil
+}
+
+// ListInstances Returns all service instances registered in the consul agent, grouped by service name.
+func ListInstances(client *http.Client, consulAddress string) (map[string][]ServiceInstance, error) {
+	instances, _, err := fetchServices(context.Background(), client, consulAddress, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return groupInstances(instances), nil
+}
+
+// fetchServices List services from consul agent. The agent endpoint does not return an index, it
+// blocks on a hash of the content. With hash set the call blocks until the services change or wait
+// has passed. Returns the new content hash, empty if consul did not send one.
+func fetchServices(ctx context.Context, client *http.Client, consulAddress string, hash string, wait time.Duration) ([]ServiceInstance, string, error) {
 	url := fmt.Sprintf("%s/v1/agent/services", consulAddress)
-	resp, err := client.Get(url)
+	if hash != "" {
+		url = fmt.Sprintf("%s?hash=%s&wait=%ds", url, hash, int(wait.Seconds()))
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed call url; url=%s", url)
+		return nil, "", errors.Wrapf(err, "Failed create request; url=%s", url)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Failed call url; url=%s", url)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, errors.Errorf("failed call consul; url=%s; code=%d", url, resp.StatusCode)
+		return nil, "", errors.Errorf("failed call consul; url=%s; code=%d", url, resp.StatusCode)
 	}
 	consulServices := make(map[string]consulService)
 	if err := json.NewDecoder(resp.Body).Decode(&consulServices); err != nil {
-		return nil, errors.Wrapf(err, "Failed read response; url=%s", url)
+		return nil, "", errors.Wrapf(err, "Failed read response; url=%s", url)
 	}
-	services := make(map[string]ServiceAddress)
+	newHash := resp.Header.Get("X-Consul-ContentHash")
+	instances := make([]ServiceInstance, 0, len(consulServices))
 	for _, v := range consulServices {
-		services[v.Service] = ServiceAddress{
-			Name:     v.Service,
-			IP:       v.Address,
+		instances = append(instances, v.toInstance())
+	}
+	sortInstances(instances)
+	return instances, newHash, nil
+}
+
+// toServiceAddresses Returns one instance per service. Last instance by ID wins.
+func toServiceAddresses(instances []ServiceInstance) map[string]ServiceAddress {
+	services := make(map[string]ServiceAddress)
+	for _, v := range instances {
+		services[v.Name] = ServiceAddress{
+			Name:     v.Name,
+			IP:       v.IP,
 			Port:     v.Port,
-			Location: fmt.Sprintf("%s:%d", v.Address, v.Port),
+			Location: v.Location,
 		}
 	}
-	return services, nil
+	return services
+}
+
+func groupInstances(instances []ServiceInstance) map[string][]ServiceInstance {
+	groups := make(map[string][]ServiceInstance)
+	for _, v := range instances {
+		groups[v.Name] = append(groups[v.Name], v)
+	}
+	return groups
 }
 
 func FindService(h *http.Client, consulAddress string, serviceName string) (*ServiceAddress, error) {
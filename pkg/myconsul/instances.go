@@ -0,0 +1,117 @@
+package myconsul
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceInstance A registered instance of a service. Several instances can have the same Name.
+type ServiceInstance struct {
+	ID         string            `json:"ID"`
+	Name       string            `json:"Name"`
+	IP         string            `json:"IP"`
+	Port       int               `json:"Port"`
+	Location   string            `json:"Location"`
+	Tags       []string          `json:"Tags"`
+	Meta       map[string]string `json:"Meta"`
+	Datacenter string            `json:"Datacenter"`
+	Node       string            `json:"Node"`
+}
+
+// HasTags Returns true if instance has all tags.
+func (s ServiceInstance) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range s.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterTags Returns instances having all tags.
+func FilterTags(instances []ServiceInstance, tags ...string) []ServiceInstance {
+	selection := []ServiceInstance{}
+	for _, s := range instances {
+		if s.HasTags(tags...) {
+			selection = append(selection, s)
+		}
+	}
+	return selection
+}
+
+type consulHealthEntry struct {
+	Node struct {
+		Node       string `json:"Node"`
+		Address    string `json:"Address"`
+		Datacenter string `json:"Datacenter"`
+	} `json:"Node"`
+	Service consulService `json:"Service"`
+}
+
+// HealthyInstances Returns all instances of a service passing their health checks,
+// optionally only those with all given tags.
+func HealthyInstances(client *http.Client, consulAddress string, serviceName string, tags ...string) ([]ServiceInstance, error) {
+	query := url.Values{}
+	query.Set("passing", "true")
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	name := url.PathEscape(serviceName)
+	url := fmt.Sprintf("%s/v1/health/service/%s?%s", consulAddress, name, query.Encode())
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed call url; url=%s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Errorf("failed call consul; url=%s; code=%d", url, resp.StatusCode)
+	}
+	entries := []consulHealthEntry{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, errors.Wrapf(err, "Failed read response; url=%s", url)
+	}
+	instances := []ServiceInstance{}
+	for _, e := range entries {
+		s := e.Service.toInstance()
+		if s.IP == "" {
+			s.IP = e.Node.Address // service registered without own address
+			s.Location = fmt.Sprintf("%s:%d", s.IP, s.Port)
+		}
+		s.Node = e.Node.Node
+		if s.Datacenter == "" {
+			s.Datacenter = e.Node.Datacenter
+		}
+		instances = append(instances, s)
+	}
+	// older consul versions ignore tag parameter
+	return FilterTags(instances, tags...), nil
+}
+
+func (v consulService) toInstance() ServiceInstance {
+	return ServiceInstance{
+		ID:         v.ID,
+		Name:       v.Service,
+		IP:         v.Address,
+		Port:       v.Port,
+		Location:   fmt.Sprintf("%s:%d", v.Address, v.Port),
+		Tags:       v.Tags,
+		Meta:       v.Meta,
+		Datacenter: v.Datacenter,
+	}
+}
+
+func sortInstances(instances []ServiceInstance) {
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+}
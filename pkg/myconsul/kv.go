@@ -0,0 +1,67 @@
+package myconsul
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type consulKV struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"` // base64 encoded, empty for null
+}
+
+// ListKV Returns all keys under prefix in consul KV store, with prefix removed from key names.
+// Folder keys (ending with /) are skipped.
+func ListKV(client *http.Client, consulAddress string, prefix string) (map[string]string, error) {
+	kv, _, err := FetchKV(context.Background(), client, consulAddress, prefix, 0, 0)
+	return kv, err
+}
+
+// FetchKV Same as ListKV, but with index > 0 the call blocks until something under prefix
+// changes or wait has passed. Returns the new consul index to use in the next call.
+func FetchKV(ctx context.Context, client *http.Client, consulAddress string, prefix string, index uint64, wait time.Duration) (map[string]string, uint64, error) {
+	url := fmt.Sprintf("%s/v1/kv/%s?recurse=true", consulAddress, strings.TrimPrefix(prefix, "/"))
+	if index > 0 {
+		url = fmt.Sprintf("%s&index=%d&wait=%ds", url, index, int(wait.Seconds()))
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "Failed create request; url=%s", url)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "Failed call url; url=%s", url)
+	}
+	defer resp.Body.Close()
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	kv := make(map[string]string)
+	if resp.StatusCode == http.StatusNotFound {
+		return kv, newIndex, nil // no keys under prefix
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, 0, errors.Errorf("failed call consul; url=%s; code=%d", url, resp.StatusCode)
+	}
+	pairs := []consulKV{}
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, errors.Wrapf(err, "Failed read response; url=%s", url)
+	}
+	for _, p := range pairs {
+		if strings.HasSuffix(p.Key, "/") {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(p.Value)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "Failed decode value; key=%s", p.Key)
+		}
+		kv[strings.TrimPrefix(p.Key, strings.TrimPrefix(prefix, "/"))] = string(value)
+	}
+	return kv, newIndex, nil
+}
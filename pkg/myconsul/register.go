@@ -0,0 +1,170 @@
+package myconsul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/version"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Registration A service to register with the local consul agent.
+type Registration struct {
+	ID      string
+	Name    string
+	Address string
+	Port    int
+	Tags    []string
+	Meta    map[string]string
+	// HealthURL is called by consul to check the service. No check is registered if empty.
+	HealthURL       string
+	CheckInterval   time.Duration // default 10s
+	CheckTimeout    time.Duration // default 5s
+	DeregisterAfter time.Duration // consul removes the service after being critical this long. 0 = never.
+}
+
+type agentRegistration struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address,omitempty"`
+	Port    int               `json:"Port,omitempty"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   *agentCheck       `json:"Check,omitempty"`
+}
+
+type agentCheck struct {
+	HTTP                           string `json:"HTTP"`
+	Interval                       string `json:"Interval"`
+	Timeout                        string `json:"Timeout"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+// Consul only accepts meta keys with letters, digits, - and _, max 64 chars.
+var metaKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// NewRegistration Registration with ID name-address-port, meta from ./build.version and
+// a health check calling healthPath (e.g. "/health") on address and port.
+func NewRegistration(name, address string, port int, healthPath string) *Registration {
+	reg := &Registration{
+		ID:      fmt.Sprintf("%s-%s-%d", name, address, port),
+		Name:    name,
+		Address: address,
+		Port:    port,
+		Meta:    make(map[string]string),
+	}
+	for k, v := range version.ReadBuildVersion(name) {
+		if k == "error" || !metaKeyRegexp.MatchString(k) {
+			continue // missing build.version or key not accepted by consul
+		}
+		if len(v) > 512 {
+			v = v[:512]
+		}
+		reg.Meta[k] = v
+	}
+	if healthPath != "" {
+		reg.HealthURL = fmt.Sprintf("http://%s:%d%s", address, port, healthPath)
+	}
+	return reg
+}
+
+// Register Register service with the local consul agent. Registering again with the same ID updates it.
+func Register(client *http.Client, consulAddress string, reg *Registration) error {
+	if reg.Name == "" {
+		return errors.New("service name missing")
+	}
+	body := agentRegistration{
+		ID:      reg.ID,
+		Name:    reg.Name,
+		Address: reg.Address,
+		Port:    reg.Port,
+		Tags:    reg.Tags,
+		Meta:    reg.Meta,
+	}
+	if body.ID == "" {
+		body.ID = reg.Name
+	}
+	if reg.HealthURL != "" {
+		body.Check = &agentCheck{
+			HTTP:     reg.HealthURL,
+			Interval: consulDuration(reg.CheckInterval, 10*time.Second),
+			Timeout:  consulDuration(reg.CheckTimeout, 5*time.Second),
+		}
+		if reg.DeregisterAfter > 0 {
+			body.Check.DeregisterCriticalServiceAfter = consulDuration(reg.DeregisterAfter, 0)
+		}
+	}
+	rawJSON, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrapf(err, "failed marshal registration; service=%s", reg.Name)
+	}
+	url := fmt.Sprintf("%s/v1/agent/service/register", consulAddress)
+	if err := put(client, url, rawJSON); err != nil {
+		return err
+	}
+	log.Info().Str("service", reg.Name).Str("id", body.ID).Str("consul", consulAddress).Msg("registered in consul")
+	return nil
+}
+
+// Deregister Remove service from the local consul agent.
+func Deregister(client *http.Client, consulAddress string, serviceID string) error {
+	id := url.PathEscape(serviceID)
+	url := fmt.Sprintf("%s/v1/agent/service/deregister/%s", consulAddress, id)
+	if err := put(client, url, nil); err != nil {
+		return err
+	}
+	log.Info().Str("id", serviceID).Str("consul", consulAddress).Msg("deregistered from consul")
+	return nil
+}
+
+// DeregisterOnSignal Deregister service when the process gets SIGINT or SIGTERM.
+// The returned channel is closed when done, after which the service should shut down.
+func DeregisterOnSignal(client *http.Client, consulAddress string, serviceID string) <-chan struct{} {
+	done := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		log.Info().Str("signal", sig.String()).Str("id", serviceID).Msg("shutting down")
+		if err := Deregister(client, consulAddress, serviceID); err != nil {
+			log.Error().Err(err).Str("id", serviceID).Msg("failed deregister from consul")
+		}
+		close(done)
+	}()
+	return done
+}
+
+func put(client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "Failed create request; url=%s", url)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed call url; url=%s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("failed call consul; url=%s; code=%d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// consulDuration Format d as consul duration, e.g. "10s". Uses def if d is 0.
+func consulDuration(d, def time.Duration) string {
+	if d <= 0 {
+		d = def
+	}
+	return d.String()
+}
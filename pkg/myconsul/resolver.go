@@ -0,0 +1,194 @@
+package myconsul
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultWait Max time a blocking query waits for changes in consul.
+const DefaultWait = 5 * time.Minute
+
+// Max delay between retries when consul can not be reached.
+const maxRetryDelay = 30 * time.Second
+
+// pollDelay Delay between queries when consul does not support blocking on the services.
+const pollDelay = 10 * time.Second
+
+// Resolver Cached copy of the services registered in the local consul agent. The cache is refreshed in the
+// background with consul blocking queries, so lookups do not call consul.
+// Services are as listed by /v1/agent/services: only those registered with the local agent, and not
+// filtered on health checks. Use HealthyInstances or ConsulDiscovery in package ws when health matters.
+type Resolver struct {
+	client        *http.Client
+	consulAddress string
+	wait          time.Duration
+
+	mu        sync.RWMutex
+	instances []ServiceInstance
+	services  map[string]ServiceAddress
+	hash      string // consul content hash of instances
+	subs      []chan struct{}
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewResolver Load services from consul and start watching for changes.
+// wait is max time of each blocking query, 0 gives DefaultWait. Client timeout must be longer than wait.
+func NewResolver(client *http.Client, consulAddress string, wait time.Duration) (*Resolver, error) {
+	if wait <= 0 {
+		wait = DefaultWait
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Resolver{
+		client:        client,
+		consulAddress: consulAddress,
+		wait:          wait,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+	instances, hash, err := fetchServices(ctx, client, consulAddress, "", 0)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	r.instances = instances
+	r.services = toServiceAddresses(instances)
+	r.hash = hash
+	go r.watch(ctx)
+	return r, nil
+}
+
+// Services Returns copy of all cached services.
+func (r *Resolver) Services() map[string]ServiceAddress {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	services := make(map[string]ServiceAddress, len(r.services))
+	for k, v := range r.services {
+		services[k] = v
+	}
+	return services
+}
+
+// FindService Returns cached address of a service.
+func (r *Resolver) FindService(serviceName string) (*ServiceAddress, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	svc, isFound := r.services[serviceName]
+	if !isFound {
+		return nil, errors.Errorf("service not in consul; service=%s; consul=%s", serviceName, r.consulAddress)
+	}
+	return &svc, nil
+}
+
+// Instances Returns cached instances of a service having all tags.
+func (r *Resolver) Instances(serviceName string, tags ...string) []ServiceInstance {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	selection := []ServiceInstance{}
+	for _, s := range r.instances {
+		if s.Name == serviceName && s.HasTags(tags...) {
+			selection = append(selection, s)
+		}
+	}
+	return selection
+}
+
+// Subscribe Returns a channel that receives a value when services change.
+// Notifications are not queued; a slow reader gets one value for several changes.
+// The channel is closed by Close.
+func (r *Resolver) Subscribe() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		close(ch)
+	default:
+		r.subs = append(r.subs, ch)
+	}
+	return ch
+}
+
+// Close Stop watching consul and close all subscription channels.
+func (r *Resolver) Close() error {
+	r.once.Do(func() {
+		r.cancel()
+		<-r.done
+	})
+	return nil
+}
+
+func (r *Resolver) watch(ctx context.Context) {
+	defer func() {
+		r.mu.Lock()
+		for _, ch := range r.subs {
+			close(ch)
+		}
+		r.subs = nil
+		r.mu.Unlock()
+		close(r.done)
+	}()
+
+	retryDelay := time.Second
+	for {
+		r.mu.RLock()
+		hash := r.hash
+		r.mu.RUnlock()
+
+		if hash == "" && !sleepContext(ctx, pollDelay) {
+			return // without a hash the query does not block
+		}
+		instances, newHash, err := fetchServices(ctx, r.client, r.consulAddress, hash, r.wait)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("consul", r.consulAddress).Msg("failed refresh services")
+			if !sleepContext(ctx, retryDelay) {
+				return
+			}
+			if retryDelay *= 2; retryDelay > maxRetryDelay {
+				retryDelay = maxRetryDelay
+			}
+			continue
+		}
+		retryDelay = time.Second
+		r.update(instances, newHash)
+	}
+}
+
+func (r *Resolver) update(instances []ServiceInstance, hash string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hash = hash
+	if reflect.DeepEqual(r.instances, instances) {
+		return
+	}
+	r.instances = instances
+	r.services = toServiceAddresses(instances)
+	for _, ch := range r.subs {
+		select {
+		case ch <- struct{}{}:
+		default: // already notified
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
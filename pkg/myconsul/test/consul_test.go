@@ -0,0 +1,215 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/myconsul"
+)
+
+// fakeConsul Stand-in for the consul agent api. Like consul it blocks on a content hash, not an index.
+type fakeConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	services map[string]map[string]interface{}
+	changed  chan struct{}
+	noHash   bool // like an agent without hash blocking
+	calls    int32
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:    1,
+		services: make(map[string]map[string]interface{}),
+		changed:  make(chan struct{}),
+	}
+}
+
+func (f *fakeConsul) register(id, name, address string, port int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services[id] = map[string]interface{}{"ID": id, "Service": name, "Address": address, "Port": port}
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&f.calls, 1)
+	hash := r.URL.Query().Get("hash")
+	f.mu.Lock()
+	changed := f.changed
+	current := f.hash()
+	f.mu.Unlock()
+	if hash != "" && hash == current {
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.noHash {
+		w.Header().Set("X-Consul-ContentHash", f.hash())
+	}
+	json.NewEncoder(w).Encode(f.services)
+}
+
+func (f *fakeConsul) hash() string {
+	return "h" + strconv.FormatUint(f.index, 16)
+}
+
+func TestResolver(t *testing.T) {
+	consul := newFakeConsul()
+	consul.register("search1", "mam-search", "10.0.0.1", 8080)
+	srv := httptest.NewServer(consul)
+	defer srv.Close()
+
+	r, err := myconsul.NewResolver(srv.Client(), srv.URL, time.Second)
+	if err != nil {
+		t.Fatalf("failed create resolver; err=%v", err)
+	}
+	svc, err := r.FindService("mam-search")
+	if err != nil || svc.Location != "10.0.0.1:8080" {
+		t.Fatalf("unexpected service; svc=%+v; err=%v", svc, err)
+	}
+
+	changes := r.Subscribe()
+	consul.register("ingest1", "mam-ingest", "10.0.0.2", 9090)
+	select {
+	case <-changes:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no change notification")
+	}
+	if _, err := r.FindService("mam-ingest"); err != nil {
+		t.Errorf("new service not found; err=%v", err)
+	}
+
+	r.Close()
+	if _, ok := <-changes; ok {
+		t.Errorf("subscription not closed")
+	}
+}
+
+func TestResolverWithoutHash(t *testing.T) {
+	consul := newFakeConsul()
+	consul.noHash = true
+	consul.register("search1", "mam-search", "10.0.0.1", 8080)
+	srv := httptest.NewServer(consul)
+	defer srv.Close()
+
+	r, err := myconsul.NewResolver(srv.Client(), srv.URL, time.Second)
+	if err != nil {
+		t.Fatalf("failed create resolver; err=%v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	r.Close()
+	if calls := atomic.LoadInt32(&consul.calls); calls != 1 {
+		t.Errorf("consul queried without delay; calls=%d", calls)
+	}
+}
+
+func TestListServices(t *testing.T) {
+	consul := newFakeConsul()
+	consul.register("search1", "mam-search", "10.0.0.1", 8080)
+	srv := httptest.NewServer(consul)
+	defer srv.Close()
+
+	services, err := myconsul.ListServices(srv.Client(), srv.URL)
+	if err != nil || len(services) != 1 || services["mam-search"].Port != 8080 {
+		t.Errorf("unexpected services; got=%+v; err=%v", services, err)
+	}
+}
+
+func TestHealthyInstances(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/mam-search" || r.URL.Query().Get("passing") == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[
+			{"Node":{"Node":"n1","Address":"10.0.0.1","Datacenter":"dc1"},
+			 "Service":{"ID":"search1","Service":"mam-search","Port":8080,"Tags":["v1","primary"],"Meta":{"version":"1.2"}}},
+			{"Node":{"Node":"n2","Address":"10.0.0.2","Datacenter":"dc1"},
+			 "Service":{"ID":"search2","Service":"mam-search","Address":"10.0.1.2","Port":8080,"Tags":["v1"]}}
+		]`))
+	}))
+	defer srv.Close()
+
+	instances, err := myconsul.HealthyInstances(srv.Client(), srv.URL, "mam-search")
+	if err != nil || len(instances) != 2 {
+		t.Fatalf("expected two instances; got=%+v; err=%v", instances, err)
+	}
+	first := instances[0]
+	if first.Location != "10.0.0.1:8080" || first.Datacenter != "dc1" || first.Meta["version"] != "1.2" || first.Node != "n1" {
+		t.Errorf("unexpected instance; got=%+v", first)
+	}
+	if instances[1].Location != "10.0.1.2:8080" {
+		t.Errorf("service address not used; got=%s", instances[1].Location)
+	}
+
+	primary, err := myconsul.HealthyInstances(srv.Client(), srv.URL, "mam-search", "primary")
+	if err != nil || len(primary) != 1 || primary[0].ID != "search1" {
+		t.Errorf("tag filter failed; got=%+v; err=%v", primary, err)
+	}
+}
+
+func TestListInstances(t *testing.T) {
+	consul := newFakeConsul()
+	consul.register("search1", "mam-search", "10.0.0.1", 8080)
+	consul.register("search2", "mam-search", "10.0.0.2", 8080)
+	srv := httptest.NewServer(consul)
+	defer srv.Close()
+
+	instances, err := myconsul.ListInstances(srv.Client(), srv.URL)
+	if err != nil || len(instances["mam-search"]) != 2 {
+		t.Errorf("expected two instances; got=%+v; err=%v", instances, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var registered map[string]interface{}
+	var deregistered string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v1/agent/service/register":
+			json.NewDecoder(r.Body).Decode(&registered)
+		case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+			deregistered = strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	reg := myconsul.NewRegistration("mam-search", "10.0.0.1", 8080, "/health")
+	reg.Tags = []string{"v1"}
+	if err := myconsul.Register(srv.Client(), srv.URL, reg); err != nil {
+		t.Fatalf("failed register; err=%v", err)
+	}
+	if registered["ID"] != "mam-search-10.0.0.1-8080" || registered["Port"] != float64(8080) {
+		t.Errorf("unexpected registration; got=%+v", registered)
+	}
+	check, _ := registered["Check"].(map[string]interface{})
+	if check["HTTP"] != "http://10.0.0.1:8080/health" || check["Interval"] != "10s" {
+		t.Errorf("unexpected check; got=%+v", check)
+	}
+
+	if err := myconsul.Deregister(srv.Client(), srv.URL, reg.ID); err != nil || deregistered != reg.ID {
+		t.Errorf("failed deregister; got=%s; err=%v", deregistered, err)
+	}
+}
@@ -18,6 +18,12 @@ func CreateHealthHandler(service string) http.Handler {
 	})
 }
 
+// ReadBuildVersion Returns values from ./build.version together with the service name.
+// Key "error" is set if the file could not be read.
+func ReadBuildVersion(service string) map[string]string {
+	return readBuildVersion(service)
+}
+
 func readBuildVersion(service string) map[string]string {
 	m := make(map[string]string)
 	m["service"] = service
@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Authenticator Adds credentials to outgoing requests.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Invalidator Implemented by authenticators with renewable credentials.
+// A Caller invalidates the credentials and calls once more when it gets a 401 reply.
+type Invalidator interface {
+	Invalidate()
+}
+
+// BasicAuth Authenticate with user and password.
+type BasicAuth struct {
+	User     string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.User, a.Password)
+	return nil
+}
+
+// BearerToken Authenticate with a static bearer token.
+type BearerToken string
+
+func (t BearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// APIKey Authenticate with a key in a request header, e.g. X-Api-Key.
+type APIKey struct {
+	Header string
+	Key    string
+}
+
+func (a APIKey) Authenticate(req *http.Request) error {
+	req.Header.Set(a.Header, a.Key)
+	return nil
+}
+
+// ClientCredentials Authenticate with bearer tokens from an OAuth2 client credentials grant.
+// The token is cached until shortly before it expires. Safe for concurrent use.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Client       *http.Client // client used to call TokenURL. Default is http.DefaultClient.
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// tokenExpiryMargin Tokens are renewed this long before they expire.
+const tokenExpiryMargin = 30 * time.Second
+
+type tokenReply struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func NewClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) *ClientCredentials {
+	return &ClientCredentials{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+	}
+}
+
+func (c *ClientCredentials) Authenticate(req *http.Request) error {
+	token, err := c.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Invalidate Drop cached token so next call fetches a new one.
+func (c *ClientCredentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+}
+
+// Token Returns cached token, or fetches a new one if missing or about to expire.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && (c.expiry.IsZero() || time.Now().Before(c.expiry)) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var reply tokenReply
+	caller := NewCaller(http.MethodPost, c.TokenURL).Content(ContentForm).Accept(ContentJSON).Auth(c.ClientID, c.ClientSecret)
+	if err := caller.CallContext(ctx, client, form, &reply); err != nil {
+		return "", errors.Wrapf(err, "failed get token")
+	}
+	if reply.AccessToken == "" {
+		return "", errors.Errorf("token missing in reply; url=%s", c.TokenURL)
+	}
+	if reply.TokenType != "" && !strings.EqualFold(reply.TokenType, "bearer") {
+		return "", errors.Errorf("unsupported token type; type=%s; url=%s", reply.TokenType, c.TokenURL)
+	}
+	c.token = reply.AccessToken
+	c.expiry = time.Time{}
+	if reply.ExpiresIn > 0 {
+		c.expiry = time.Now().Add(time.Duration(reply.ExpiresIn)*time.Second - tokenExpiryMargin)
+	}
+	return c.token, nil
+}
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// requestBody Body of a call. Encoded input is kept in buf and can be resent on retry.
+// Streamed input (an io.Reader) is sent as is and can only be resent if it is an io.Seeker.
+type requestBody struct {
+	contentType string
+	buf         []byte
+	reader      io.Reader
+	length      int64 // -1 if unknown, which gives chunked transfer encoding
+	offset      int64 // start position of a seekable reader
+	opened      bool
+}
+
+func newStreamBody(r io.Reader) *requestBody {
+	b := &requestBody{reader: r, length: streamLength(r)}
+	if s, ok := r.(io.Seeker); ok {
+		if offset, err := s.Seek(0, io.SeekCurrent); err == nil {
+			b.offset = offset
+		}
+	}
+	return b
+}
+
+// canRepeat Returns true if body can be sent again.
+func (b *requestBody) canRepeat() bool {
+	if b.reader == nil {
+		return true
+	}
+	_, ok := b.reader.(io.Seeker)
+	return ok
+}
+
+// open Returns reader and content length for the next attempt.
+func (b *requestBody) open() (io.ReadCloser, int64, error) {
+	if b.reader == nil {
+		return ioutil.NopCloser(bytes.NewReader(b.buf)), int64(len(b.buf)), nil
+	}
+	if b.opened {
+		if _, err := b.reader.(io.Seeker).Seek(b.offset, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+	}
+	b.opened = true
+	// NopCloser so http client does not close e.g. a file owned by the caller.
+	return ioutil.NopCloser(b.reader), b.length, nil
+}
+
+// streamLength Returns number of bytes left in r, or -1 if unknown.
+func streamLength(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *os.File:
+		fi, err := v.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return fi.Size() - offset
+	default:
+		return -1
+	}
+}
+
+// setBody Set body on req. Empty bodies are sent as http.NoBody.
+func setBody(req *http.Request, body io.ReadCloser, length int64) {
+	if length == 0 {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+		return
+	}
+	req.Body = body
+	req.ContentLength = length
+}
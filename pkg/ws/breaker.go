@@ -0,0 +1,268 @@
+package ws
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBreakerOpen Cause of the WebError returned when a call is stopped by an open circuit breaker.
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerSettings Thresholds for when a breaker opens and closes again.
+type BreakerSettings struct {
+	MinRequests  int           // calls needed in a window before failure ratio is checked.
+	FailureRatio float64       // breaker opens when failures/calls reaches this ratio.
+	Window       time.Duration // counters are reset after this time while closed.
+	CoolDown     time.Duration // time in open state before trial calls are let through.
+	HalfOpenMax  int           // successful trial calls needed to close the breaker.
+}
+
+// DefaultBreakerSettings Opens when half of at least 10 calls within a minute fail.
+func DefaultBreakerSettings() BreakerSettings {
+	return BreakerSettings{
+		MinRequests:  10,
+		FailureRatio: 0.5,
+		Window:       time.Minute,
+		CoolDown:     30 * time.Second,
+		HalfOpenMax:  1,
+	}
+}
+
+// BreakerStatus Snapshot of a breaker, e.g. for health pages.
+type BreakerStatus struct {
+	Host     string    `json:"host"`
+	State    string    `json:"state"`
+	Calls    int       `json:"calls"`
+	Failures int       `json:"failures"`
+	OpenedAt time.Time `json:"openedAt,omitempty"`
+}
+
+// Breaker Circuit breaker for a single downstream host.
+type Breaker struct {
+	mu          sync.Mutex
+	host        string
+	settings    BreakerSettings
+	state       BreakerState
+	windowStart time.Time
+	calls       int
+	failures    int
+	openedAt    time.Time
+	trials      int // trial calls in flight while half open
+	successes   int // successful trial calls while half open
+}
+
+func newBreaker(host string, settings BreakerSettings) *Breaker {
+	return &Breaker{host: host, settings: settings, windowStart: time.Now()}
+}
+
+// Allow Returns false if calls to the host should fail fast.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.settings.CoolDown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trials = 0
+		b.successes = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.trials >= b.halfOpenMax() {
+			return false
+		}
+		b.trials++
+		return true
+	default:
+		if b.settings.Window > 0 && now.Sub(b.windowStart) > b.settings.Window {
+			b.reset(now)
+		}
+		return true
+	}
+}
+
+// Record Register the outcome of a call that was allowed.
+func (b *Breaker) Record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case BreakerHalfOpen:
+		b.trials--
+		if !success {
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.halfOpenMax() {
+			b.state = BreakerClosed
+			b.reset(now)
+		}
+	case BreakerClosed:
+		b.calls++
+		if !success {
+			b.failures++
+		}
+		if b.calls >= b.settings.MinRequests && float64(b.failures)/float64(b.calls) >= b.settings.FailureRatio {
+			b.open(now)
+		}
+	}
+}
+
+// release Forget a call that was allowed but aborted before it had an outcome.
+func (b *Breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+func (b *Breaker) halfOpenMax() int {
+	if b.settings.HalfOpenMax < 1 {
+		return 1
+	}
+	return b.settings.HalfOpenMax
+}
+
+// State Returns current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.settings.CoolDown {
+		return BreakerHalfOpen // next call will be a trial
+	}
+	return b.state
+}
+
+// Status Returns a snapshot of the breaker.
+func (b *Breaker) Status() BreakerStatus {
+	state := b.State()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerStatus{
+		Host:     b.host,
+		State:    state.String(),
+		Calls:    b.calls,
+		Failures: b.failures,
+		OpenedAt: b.openedAt,
+	}
+}
+
+func (b *Breaker) open(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.trials = 0
+	b.successes = 0
+}
+
+func (b *Breaker) reset(now time.Time) {
+	b.windowStart = now
+	b.calls = 0
+	b.failures = 0
+}
+
+// Breakers Circuit breakers keyed by host. Safe for concurrent use and meant to be shared by Callers.
+type Breakers struct {
+	mu       sync.Mutex
+	settings BreakerSettings
+	hosts    map[string]*Breaker
+}
+
+func NewBreakers(settings BreakerSettings) *Breakers {
+	return &Breakers{
+		settings: settings,
+		hosts:    make(map[string]*Breaker),
+	}
+}
+
+// Get Returns the breaker for host, creating it if needed.
+func (b *Breakers) Get(host string) *Breaker {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, isFound := b.hosts[host]
+	if !isFound {
+		br = newBreaker(host, b.settings)
+		b.hosts[host] = br
+	}
+	return br
+}
+
+// Status Returns snapshot of all breakers sorted by host.
+func (b *Breakers) Status() []BreakerStatus {
+	b.mu.Lock()
+	list := make([]*Breaker, 0, len(b.hosts))
+	for _, br := range b.hosts {
+		list = append(list, br)
+	}
+	b.mu.Unlock()
+
+	status := make([]BreakerStatus, 0, len(list))
+	for _, br := range list {
+		status = append(status, br.Status())
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Host < status[j].Host })
+	return status
+}
+
+// Handler Returns a http handler listing state of all breakers as json.
+func (b *Breakers) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ReplyJSON(w, b.Status())
+	})
+}
+
+// IsBreakerOpen Returns true if err is caused by an open circuit breaker.
+func IsBreakerOpen(err error) bool {
+	webErr, ok := errors.Cause(err).(*WebError)
+	return ok && webErr.Cause == ErrBreakerOpen
+}
+
+// isBreakerFailure Returns true if a call result should count as a failure for the breaker.
+func isBreakerFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
@@ -0,0 +1,360 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ContentForm      = "application/x-www-form-urlencoded"
+	ContentMultipart = "multipart/form-data"
+	ContentNDJSON    = "application/x-ndjson"
+	ContentCSV       = "text/csv"
+)
+
+// Codec Encodes request bodies and decodes replies for one or more media types.
+type Codec interface {
+	// Match Returns true if codec handles mediaType. Media type is lower case without parameters.
+	Match(mediaType string) bool
+	// Encode Write v to w. Returns the Content-Type to send, normally contentType unchanged.
+	Encode(w io.Writer, v interface{}, contentType string) (string, error)
+	// Decode Read r into v. contentType is the full Content-Type of the reply.
+	Decode(r io.Reader, v interface{}, contentType string) error
+}
+
+// Codecs Registry of codecs looked up by content type. Safe for concurrent use.
+type Codecs struct {
+	mu     sync.RWMutex
+	codecs []Codec
+}
+
+// DefaultCodecs Used by Callers without own registry. Register codecs here to make them available to all Callers.
+var DefaultCodecs = NewCodecs(
+	JSONCodec{},
+	XMLCodec{},
+	PlainCodec{},
+	FormCodec{},
+	MultipartCodec{},
+	NDJSONCodec{},
+	CSVCodec{},
+)
+
+func NewCodecs(codecs ...Codec) *Codecs {
+	r := &Codecs{}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+	return r
+}
+
+// Register Add a codec. Codecs registered later take precedence for media types matched by several codecs.
+func (r *Codecs) Register(c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs = append([]Codec{c}, r.codecs...)
+}
+
+// Lookup Returns codec for a content type, e.g. "application/vnd.mam.item+json; charset=utf-8".
+func (r *Codecs) Lookup(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.codecs {
+		if c.Match(mediaType) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// JSONCodec Handles application/json and all +json vendor types.
+type JSONCodec struct{}
+
+func (JSONCodec) Match(mediaType string) bool {
+	return mediaType == ContentJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+func (JSONCodec) Encode(w io.Writer, v interface{}, contentType string) (string, error) {
+	return contentType, json.NewEncoder(w).Encode(v)
+}
+
+func (JSONCodec) Decode(r io.Reader, v interface{}, contentType string) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// XMLCodec Handles application/xml, text/xml and all +xml vendor types.
+type XMLCodec struct{}
+
+func (XMLCodec) Match(mediaType string) bool {
+	return mediaType == ContentXML || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+func (XMLCodec) Encode(w io.Writer, v interface{}, contentType string) (string, error) {
+	return contentType, xml.NewEncoder(w).Encode(v)
+}
+
+func (XMLCodec) Decode(r io.Reader, v interface{}, contentType string) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// PlainCodec Handles text/plain. Encodes string, []byte and fmt.Stringer. Decodes into *string and *[]byte.
+type PlainCodec struct{}
+
+func (PlainCodec) Match(mediaType string) bool {
+	return mediaType == ContentPlain
+}
+
+func (PlainCodec) Encode(w io.Writer, v interface{}, contentType string) (string, error) {
+	var err error
+	switch t := v.(type) {
+	case string:
+		_, err = io.WriteString(w, t)
+	case []byte:
+		_, err = w.Write(t)
+	case fmt.Stringer:
+		_, err = io.WriteString(w, t.String())
+	default:
+		err = errors.Errorf("can not encode %T as text", v)
+	}
+	return contentType, err
+}
+
+func (PlainCodec) Decode(r io.Reader, v interface{}, contentType string) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case *string:
+		*t = string(buf)
+	case *[]byte:
+		*t = buf
+	default:
+		return errors.Errorf("can not decode text into %T", v)
+	}
+	return nil
+}
+
+// FormCodec Handles application/x-www-form-urlencoded. Encodes url.Values and map[string]string. Decodes into *url.Values.
+type FormCodec struct{}
+
+func (FormCodec) Match(mediaType string) bool {
+	return mediaType == ContentForm
+}
+
+func (FormCodec) Encode(w io.Writer, v interface{}, contentType string) (string, error) {
+	var values url.Values
+	switch t := v.(type) {
+	case url.Values:
+		values = t
+	case map[string]string:
+		values = make(url.Values)
+		for k, s := range t {
+			values.Set(k, s)
+		}
+	default:
+		return contentType, errors.Errorf("can not encode %T as form", v)
+	}
+	_, err := io.WriteString(w, values.Encode())
+	return contentType, err
+}
+
+func (FormCodec) Decode(r io.Reader, v interface{}, contentType string) error {
+	values, ok := v.(*url.Values)
+	if !ok {
+		return errors.Errorf("can not decode form into %T", v)
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	parsed, err := url.ParseQuery(string(buf))
+	if err != nil {
+		return err
+	}
+	*values = parsed
+	return nil
+}
+
+// MultipartForm Fields and files of a multipart/form-data body.
+type MultipartForm struct {
+	Fields url.Values
+	Files  []MultipartFile
+}
+
+// MultipartFile A file part. Decoded files are read into memory.
+type MultipartFile struct {
+	Field       string
+	FileName    string
+	ContentType string
+	Reader      io.Reader
+}
+
+// MultipartCodec Handles multipart/form-data. Encodes and decodes *MultipartForm.
+type MultipartCodec struct{}
+
+func (MultipartCodec) Match(mediaType string) bool {
+	return mediaType == ContentMultipart
+}
+
+func (MultipartCodec) Encode(w io.Writer, v interface{}, contentType string) (string, error) {
+	form, ok := v.(*MultipartForm)
+	if !ok {
+		return contentType, errors.Errorf("can not encode %T as multipart", v)
+	}
+	mw := multipart.NewWriter(w)
+	for name, values := range form.Fields {
+		for _, value := range values {
+			if err := mw.WriteField(name, value); err != nil {
+				return contentType, err
+			}
+		}
+	}
+	for _, f := range form.Files {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": f.Field, "filename": f.FileName}))
+		if f.ContentType != "" {
+			h.Set("Content-Type", f.ContentType)
+		} else {
+			h.Set("Content-Type", "application/octet-stream")
+		}
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return contentType, err
+		}
+		if _, err := io.Copy(part, f.Reader); err != nil {
+			return contentType, err
+		}
+	}
+	return mw.FormDataContentType(), mw.Close()
+}
+
+func (MultipartCodec) Decode(r io.Reader, v interface{}, contentType string) error {
+	form, ok := v.(*MultipartForm)
+	if !ok {
+		return errors.Errorf("can not decode multipart into %T", v)
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return errors.Errorf("multipart boundary missing; contentType=%s", contentType)
+	}
+	form.Fields = make(url.Values)
+	mr := multipart.NewReader(r, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		buf, err := ioutil.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			form.Fields.Add(part.FormName(), string(buf))
+			continue
+		}
+		form.Files = append(form.Files, MultipartFile{
+			Field:       part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Reader:      bytes.NewReader(buf),
+		})
+	}
+}
+
+// NDJSONCodec Handles application/x-ndjson. Encodes a slice as one json value per line and
+// decodes lines into a pointer to slice.
+type NDJSONCodec struct{}
+
+func (NDJSONCodec) Match(mediaType string) bool {
+	return mediaType == ContentNDJSON || mediaType == "application/jsonl"
+}
+
+func (NDJSONCodec) Encode(w io.Writer, v interface{}, contentType string) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return contentType, errors.Errorf("can not encode %T as ndjson", v)
+	}
+	enc := json.NewEncoder(w) // Encode ends each value with newline
+	for i := 0; i < rv.Len(); i++ {
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return contentType, err
+		}
+	}
+	return contentType, nil
+}
+
+func (NDJSONCodec) Decode(r io.Reader, v interface{}, contentType string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("can not decode ndjson into %T", v)
+	}
+	list := rv.Elem()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		item := reflect.New(list.Type().Elem())
+		if err := json.Unmarshal(line, item.Interface()); err != nil {
+			return err
+		}
+		list.Set(reflect.Append(list, item.Elem()))
+	}
+	return scanner.Err()
+}
+
+// CSVCodec Handles text/csv. Encodes [][]string and decodes into *[][]string.
+type CSVCodec struct{}
+
+func (CSVCodec) Match(mediaType string) bool {
+	return mediaType == ContentCSV
+}
+
+func (CSVCodec) Encode(w io.Writer, v interface{}, contentType string) (string, error) {
+	records, ok := v.([][]string)
+	if !ok {
+		return contentType, errors.Errorf("can not encode %T as csv", v)
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return contentType, err
+	}
+	return contentType, nil
+}
+
+func (CSVCodec) Decode(r io.Reader, v interface{}, contentType string) error {
+	records, ok := v.(*[][]string)
+	if !ok {
+		return errors.Errorf("can not decode csv into %T", v)
+	}
+	list, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	*records = list
+	return nil
+}
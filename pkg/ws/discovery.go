@@ -0,0 +1,180 @@
+package ws
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/myconsul"
+	"github.com/pkg/errors"
+)
+
+// Url schemes resolved through Discovery. consul://mam-search/v1/items is called as
+// http://<instance>/v1/items and consul+https:// as https.
+const (
+	SchemeConsul      = "consul"
+	SchemeConsulHTTPS = "consul+https"
+)
+
+// Discovery Returns addresses (host:port) of healthy instances of a service.
+type Discovery interface {
+	Instances(service string) ([]string, error)
+}
+
+// DefaultDiscovery Used for consul urls by Callers without own Discovery.
+var DefaultDiscovery Discovery
+
+// ConsulDiscovery Finds healthy service instances with myconsul.
+type ConsulDiscovery struct {
+	Client  *http.Client
+	Address string   // consul address, e.g. http://localhost:8500
+	Tags    []string // only use instances with all tags
+}
+
+func NewConsulDiscovery(client *http.Client, consulAddress string, tags ...string) *ConsulDiscovery {
+	return &ConsulDiscovery{Client: client, Address: consulAddress, Tags: tags}
+}
+
+func (d *ConsulDiscovery) Instances(service string) ([]string, error) {
+	instances, err := myconsul.HealthyInstances(d.Client, d.Address, service, d.Tags...)
+	if err != nil {
+		return nil, err
+	}
+	return locations(instances), nil
+}
+
+// ResolverDiscovery Finds service instances in the cache of a myconsul.Resolver.
+type ResolverDiscovery struct {
+	Resolver *myconsul.Resolver
+	Tags     []string // only use instances with all tags
+}
+
+func (d ResolverDiscovery) Instances(service string) ([]string, error) {
+	return locations(d.Resolver.Instances(service, d.Tags...)), nil
+}
+
+func locations(instances []myconsul.ServiceInstance) []string {
+	list := make([]string, 0, len(instances))
+	for _, s := range instances {
+		list = append(list, s.Location)
+	}
+	return list
+}
+
+// Balancer Decides in which order instances of a service are tried.
+type Balancer interface {
+	// Order Returns instances in the order they should be tried.
+	Order(service string, instances []string) []string
+	// Report Tell the balancer if a call to an instance failed to connect.
+	Report(service, instance string, failed bool)
+}
+
+// DefaultBalancer Used by Callers without own Balancer.
+var DefaultBalancer Balancer = NewRoundRobin()
+
+// RoundRobin Starts with the next instance for each call.
+type RoundRobin struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{next: make(map[string]int)}
+}
+
+func (b *RoundRobin) Order(service string, instances []string) []string {
+	b.mu.Lock()
+	start := b.next[service]
+	b.next[service] = start + 1
+	b.mu.Unlock()
+
+	ordered := make([]string, 0, len(instances))
+	for i := range instances {
+		ordered = append(ordered, instances[(start+i)%len(instances)])
+	}
+	return ordered
+}
+
+func (b *RoundRobin) Report(service, instance string, failed bool) {}
+
+// LeastRecentlyFailed Prefers instances that have not failed, then those that failed longest ago.
+type LeastRecentlyFailed struct {
+	mu     sync.Mutex
+	failed map[string]time.Time // key is service/instance
+}
+
+func NewLeastRecentlyFailed() *LeastRecentlyFailed {
+	return &LeastRecentlyFailed{failed: make(map[string]time.Time)}
+}
+
+func (b *LeastRecentlyFailed) Order(service string, instances []string) []string {
+	ordered := append([]string(nil), instances...)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return b.failed[service+"/"+ordered[i]].Before(b.failed[service+"/"+ordered[j]])
+	})
+	return ordered
+}
+
+func (b *LeastRecentlyFailed) Report(service, instance string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if failed {
+		b.failed[service+"/"+instance] = time.Now()
+	} else {
+		delete(b.failed, service+"/"+instance)
+	}
+}
+
+// isDiscoveryURL Returns true if u should be resolved through Discovery.
+func isDiscoveryURL(u *url.URL) bool {
+	return u.Scheme == SchemeConsul || u.Scheme == SchemeConsulHTTPS
+}
+
+// instanceURL Returns u with service replaced by instance address.
+func instanceURL(u *url.URL, instance string) string {
+	target := *u
+	target.Scheme = "http"
+	if u.Scheme == SchemeConsulHTTPS {
+		target.Scheme = "https"
+	}
+	target.Host = instance
+	return target.String()
+}
+
+// isFailoverError Returns true if the next instance can be tried after err. Calls that never reached the
+// instance, because of an open breaker or a failed dial, always fail over. Other transport errors, e.g. a
+// timeout after the request was sent, only fail over if repeating the call is allowed.
+func isFailoverError(err error, repeatable bool) bool {
+	if IsBreakerOpen(err) {
+		return true
+	}
+	webErr, ok := errors.Cause(err).(*WebError)
+	if !ok {
+		return false
+	}
+	urlErr, isTransport := webErr.Cause.(*url.Error)
+	if !isTransport {
+		return false
+	}
+	return repeatable || isDialError(urlErr)
+}
+
+// isDialError Returns true if err is from connecting, e.g. connection refused, so nothing was sent.
+func isDialError(err error) bool {
+	for err != nil {
+		if opErr, ok := err.(*net.OpError); ok {
+			return opErr.Op == "dial"
+		}
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = wrapper.Unwrap()
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package ws
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets Upper bounds in seconds of the call duration histogram.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultMetrics Collects metrics for all calls made by Callers. Set to nil to disable.
+var DefaultMetrics = NewMetrics(DefaultBuckets)
+
+// Metrics Counters and duration histograms of outbound calls, per host, method and status code.
+// Calls without a reply have code "error". Safe for concurrent use.
+type Metrics struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[metricKey]*metricSeries
+}
+
+type metricKey struct {
+	host   string
+	method string
+	code   string
+}
+
+type metricSeries struct {
+	count   uint64
+	sum     float64
+	buckets []uint64 // cumulative counts per bucket
+}
+
+func NewMetrics(buckets []float64) *Metrics {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Metrics{
+		buckets: b,
+		series:  make(map[metricKey]*metricSeries),
+	}
+}
+
+// Observe Record a call.
+func (m *Metrics) Observe(host, method, code string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	secs := d.Seconds()
+	key := metricKey{host: host, method: method, code: code}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, isFound := m.series[key]
+	if !isFound {
+		s = &metricSeries{buckets: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	s.count++
+	s.sum += secs
+	for i, upper := range m.buckets {
+		if secs <= upper {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Middleware Returns middleware recording calls in m.
+func (m *Metrics) Middleware() Middleware {
+	return ObserveMiddleware(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		m.Observe(req.URL.Host, req.Method, code, d)
+	})
+}
+
+// Handler Returns a http handler exposing metrics in Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.Write(w)
+	})
+}
+
+// Write Write metrics in Prometheus text format to w.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	keys := make([]metricKey, 0, len(m.series))
+	series := make(map[metricKey]metricSeries, len(m.series))
+	for k, s := range m.series {
+		keys = append(keys, k)
+		series[k] = metricSeries{count: s.count, sum: s.sum, buckets: append([]uint64(nil), s.buckets...)}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP ws_client_requests_total Outbound calls made by ws.Caller.")
+	fmt.Fprintln(bw, "# TYPE ws_client_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(bw, "ws_client_requests_total{%s} %d\n", k.labels(), series[k].count)
+	}
+	fmt.Fprintln(bw, "# HELP ws_client_request_duration_seconds Duration of outbound calls made by ws.Caller.")
+	fmt.Fprintln(bw, "# TYPE ws_client_request_duration_seconds histogram")
+	for _, k := range keys {
+		s := series[k]
+		labels := k.labels()
+		for i, upper := range m.buckets {
+			fmt.Fprintf(bw, "ws_client_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(upper), s.buckets[i])
+		}
+		fmt.Fprintf(bw, "ws_client_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, s.count)
+		fmt.Fprintf(bw, "ws_client_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(s.sum))
+		fmt.Fprintf(bw, "ws_client_request_duration_seconds_count{%s} %d\n", labels, s.count)
+	}
+	return bw.Flush()
+}
+
+func (k metricKey) labels() string {
+	return fmt.Sprintf(`host="%s",method="%s",code="%s"`, escapeLabel(k.host), escapeLabel(k.method), escapeLabel(k.code))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
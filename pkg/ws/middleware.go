@@ -0,0 +1,203 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// RoundTripFunc Sends a request and returns the reply.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware Wraps a RoundTripFunc to add behaviour around outbound calls.
+// Middleware is called once per attempt, after credentials are added.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// RequestIDHeader Header used to propagate request id.
+const RequestIDHeader = "X-Request-Id"
+
+// RedactHeaders Headers whose values are never logged.
+var RedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// RedactHeaderPatterns Headers with a name containing any of these (lower case) are never logged either,
+// e.g. an APIKey sent in X-Mam-Key.
+var RedactHeaderPatterns = []string{"key", "token", "secret", "auth", "password", "credential", "session"}
+
+var (
+	defaultMu    sync.RWMutex
+	defaultChain []Middleware
+)
+
+// UseDefault Add middleware to the default chain. The default chain runs for all Callers, before their own middleware.
+func UseDefault(m ...Middleware) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultChain = append(defaultChain, m...)
+}
+
+// ResetDefault Remove all middleware from the default chain.
+func ResetDefault() {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultChain = nil
+}
+
+// chain Wrap final with middleware. First middleware is outermost.
+func chain(final RoundTripFunc, lists ...[]Middleware) RoundTripFunc {
+	var all []Middleware
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	next := final
+	for i := len(all) - 1; i >= 0; i-- {
+		next = all[i](next)
+	}
+	return next
+}
+
+func getDefaultChain() []Middleware {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultChain
+}
+
+// LogMiddleware Log each call to logger. Headers in RedactHeaders or matching RedactHeaderPatterns are logged as ***,
+// as are url passwords and query parameters matching them.
+func LogMiddleware(logger zerolog.Logger) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			var e *zerolog.Event
+			if err != nil {
+				e = logger.Error().Err(err)
+			} else if resp.StatusCode >= 500 {
+				e = logger.Warn().Int("status", resp.StatusCode)
+			} else {
+				e = logger.Info().Int("status", resp.StatusCode)
+			}
+			e.Str("method", req.Method).
+				Str("url", redactURL(req.URL)).
+				Dur("duration", time.Since(start)).
+				Dict("headers", headerDict(req.Header)).
+				Msg("ws call")
+			return resp, err
+		}
+	}
+}
+
+func headerDict(h http.Header) *zerolog.Event {
+	d := zerolog.Dict()
+	for k, v := range h {
+		if isRedacted(k) {
+			d.Str(k, "***")
+			continue
+		}
+		d.Str(k, strings.Join(v, ", "))
+	}
+	return d
+}
+
+// redactURL Returns u without password and with values of redacted query parameters, e.g. access_token, as ***.
+func redactURL(u *url.URL) string {
+	r := *u
+	if r.RawQuery != "" {
+		params := strings.Split(r.RawQuery, "&")
+		for i, param := range params {
+			name := param
+			if index := strings.Index(param, "="); index >= 0 {
+				name = param[:index]
+			}
+			if unescaped, err := url.QueryUnescape(name); err == nil && isRedacted(unescaped) {
+				params[i] = name + "=***"
+			}
+		}
+		r.RawQuery = strings.Join(params, "&")
+	}
+	return r.Redacted()
+}
+
+func isRedacted(header string) bool {
+	for _, h := range RedactHeaders {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	lower := strings.ToLower(header)
+	for _, pattern := range RedactHeaderPatterns {
+		if strings.Contains(lower, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// ObserveFunc Called after each call with the outcome. resp is nil if err is set.
+type ObserveFunc func(req *http.Request, resp *http.Response, err error, duration time.Duration)
+
+// ObserveMiddleware Report outcome and duration of each call to fn, e.g. to collect metrics.
+func ObserveMiddleware(fn ObserveFunc) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(req)
+			fn(req, resp, err, time.Since(start))
+			return resp, err
+		}
+	}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID Returns ctx carrying a request id to propagate in outbound calls.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID Returns request id in ctx, or empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware Set RequestIDHeader from request context. A new id is generated if ctx has none.
+func RequestIDMiddleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(RequestIDHeader) == "" {
+				id := RequestID(req.Context())
+				if id == "" {
+					id = newRequestID()
+				}
+				req.Header.Set(RequestIDHeader, id)
+			}
+			return next(req)
+		}
+	}
+}
+
+// RequestIDHandler Put request id of inbound requests into the request context, so it
+// is propagated by RequestIDMiddleware. A new id is generated if the header is missing.
+func RequestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
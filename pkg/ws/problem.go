@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+// ContentProblemJSON Media type of RFC 7807 error bodies.
+const ContentProblemJSON = "application/problem+json"
+
+// MaxErrorBody Max number of bytes of an error reply body kept in WebError.
+var MaxErrorBody int64 = 4096
+
+// Problem RFC 7807 problem details. Members not defined by the rfc are kept in Extensions.
+type Problem struct {
+	Type       string                 `json:"type,omitempty"`
+	Title      string                 `json:"title,omitempty"`
+	Status     int                    `json:"status,omitempty"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// ParseProblem Parse a problem+json body. Returns nil if body is not a json object.
+func ParseProblem(body []byte) *Problem {
+	members := make(map[string]interface{})
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil
+	}
+	p := &Problem{Extensions: make(map[string]interface{})}
+	for k, v := range members {
+		switch k {
+		case "type":
+			p.Type, _ = v.(string)
+		case "title":
+			p.Title, _ = v.(string)
+		case "status":
+			if n, ok := v.(float64); ok {
+				p.Status = int(n)
+			}
+		case "detail":
+			p.Detail, _ = v.(string)
+		case "instance":
+			p.Instance, _ = v.(string)
+		default:
+			p.Extensions[k] = v
+		}
+	}
+	return p
+}
+
+// readErrorBody Read at most MaxErrorBody bytes of the body and discard the rest.
+// If the reply is problem+json it is also parsed.
+func readErrorBody(resp *http.Response) (string, *Problem) {
+	defer DiscardBody(resp)
+	buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxErrorBody))
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != ContentProblemJSON {
+		return string(buf), nil
+	}
+	return string(buf), ParseProblem(buf)
+}
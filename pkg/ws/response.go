@@ -0,0 +1,35 @@
+package ws
+
+import (
+	"io"
+	"net/http"
+)
+
+// Response Status and headers of the reply to a call made by a Caller.
+// Headers are kept with all values, e.g. multiple Set-Cookie or Link headers.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Attempts   int // number of calls made, including retries
+	// ContentLength of the reply body, -1 if unknown (e.g. chunked).
+	ContentLength int64
+	// Body of the reply. Only set by Caller.Stream and must then be closed.
+	Body io.ReadCloser
+}
+
+func newResponse(resp *http.Response, attempts int) *Response {
+	return &Response{
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		Attempts:      attempts,
+		ContentLength: resp.ContentLength,
+	}
+}
+
+// HeaderValues Returns all values of a reply header.
+func (r *Response) HeaderValues(name string) []string {
+	if r == nil {
+		return nil
+	}
+	return r.Header[http.CanonicalHeaderKey(name)]
+}
@@ -0,0 +1,118 @@
+package ws
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy Controls how a Caller retries failed calls.
+// Transport errors and replies with a status code in RetryCodes are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, including the first one. <= 1 disables retries.
+	BaseDelay   time.Duration // delay before first retry. Doubled for each following retry.
+	MaxDelay    time.Duration // upper limit of a single delay, also applied to Retry-After.
+	Jitter      float64       // fraction (0-1) of the delay that is randomized.
+	RetryCodes  []int         // http status codes that are retried.
+	AllMethods  bool          // also retry methods that are not idempotent, e.g. POST and PATCH.
+}
+
+// DefaultRetryPolicy Returns a policy with 3 attempts retrying 429, 502, 503 and 504.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.2,
+		RetryCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// shouldRetry Returns true if a call that ended with resp/err should be made again.
+func (p *RetryPolicy) shouldRetry(method string, attempt int, resp *http.Response, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if !p.AllMethods && !isIdempotent(method) {
+		return false
+	}
+	if err != nil {
+		return !IsBreakerOpen(err) // transport error
+	}
+	return p.isRetryCode(resp.StatusCode)
+}
+
+func (p *RetryPolicy) isRetryCode(code int) bool {
+	for _, c := range p.RetryCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay Returns time to wait before next attempt. A Retry-After header in resp has precedence over backoff.
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp); ok {
+		return p.limit(d)
+	}
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < math.MaxInt64/2; i++ { // capped by limit, not here, as MaxDelay 0 is no cap
+		d *= 2
+	}
+	d = p.limit(d)
+	if p.Jitter > 0 && d > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+func (p *RetryPolicy) limit(d time.Duration) time.Duration {
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// retryAfter Parse Retry-After header. Value is either seconds or a http date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
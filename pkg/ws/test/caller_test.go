@@ -0,0 +1,591 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matobi/mam-go-lib/pkg/ws"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+type item struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func fastRetry() *ws.RetryPolicy {
+	p := ws.DefaultRetryPolicy()
+	p.BaseDelay = time.Millisecond
+	p.MaxDelay = 10 * time.Millisecond
+	return p
+}
+
+// failingServer replies with code for the first n calls, then with a json item.
+func failingServer(n int32, code int, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= n {
+			w.WriteHeader(code)
+			return
+		}
+		ws.ReplyJSON(w, item{ID: "1", Name: "one"})
+	}))
+}
+
+func TestCallJSON(t *testing.T) {
+	var calls int32
+	srv := failingServer(0, 0, &calls)
+	defer srv.Close()
+
+	var out item
+	if err := ws.NewCaller(http.MethodGet, srv.URL).JSON().Call(srv.Client(), nil, &out); err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	if out.ID != "1" || out.Name != "one" {
+		t.Errorf("unexpected reply; got=%+v", out)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := failingServer(2, http.StatusServiceUnavailable, &calls)
+	defer srv.Close()
+
+	var out item
+	err := ws.NewCaller(http.MethodGet, srv.URL).JSON().Retry(fastRetry()).Call(srv.Client(), nil, &out)
+	if err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	if calls != 3 {
+		t.Errorf("unexpected number of calls; exp=3; got=%d", calls)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var calls int32
+	srv := failingServer(10, http.StatusBadGateway, &calls)
+	defer srv.Close()
+
+	err := ws.NewCaller(http.MethodGet, srv.URL).JSON().Retry(fastRetry()).Call(srv.Client(), nil, nil)
+	webErr, ok := errors.Cause(err).(*ws.WebError)
+	if !ok {
+		t.Fatalf("expected WebError; got=%v", err)
+	}
+	if webErr.Attempts != 3 || webErr.Code != http.StatusBadGateway {
+		t.Errorf("unexpected error; attempts=%d; code=%d", webErr.Attempts, webErr.Code)
+	}
+	if ws.GetErrCode(err) != http.StatusBadGateway {
+		t.Errorf("unexpected error code; got=%d", ws.GetErrCode(err))
+	}
+}
+
+func TestRetryBackoffWithoutMaxDelay(t *testing.T) {
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p := &ws.RetryPolicy{MaxAttempts: 4, BaseDelay: 20 * time.Millisecond, RetryCodes: []int{http.StatusServiceUnavailable}}
+	ws.NewCaller(http.MethodGet, srv.URL).Retry(p).Call(srv.Client(), nil, nil)
+	if len(times) != 4 {
+		t.Fatalf("unexpected number of calls; exp=4; got=%d", len(times))
+	}
+	// delays 20, 40 and 80ms
+	if gap := times[3].Sub(times[2]); gap < 80*time.Millisecond {
+		t.Errorf("delay not doubled without MaxDelay; gap=%v", gap)
+	}
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	var calls int32
+	srv := failingServer(1, http.StatusServiceUnavailable, &calls)
+	defer srv.Close()
+
+	in := item{ID: "2"}
+	if err := ws.NewCaller(http.MethodPost, srv.URL).JSON().Retry(fastRetry()).Call(srv.Client(), &in, nil); err == nil {
+		t.Errorf("expected error for POST without retry")
+	}
+	if calls != 1 {
+		t.Errorf("POST retried; calls=%d", calls)
+	}
+
+	calls = 0
+	p := fastRetry()
+	p.AllMethods = true
+	if err := ws.NewCaller(http.MethodPost, srv.URL).JSON().Retry(p).Call(srv.Client(), &in, nil); err != nil {
+		t.Errorf("unexpected error; err=%v", err)
+	}
+	if calls != 2 {
+		t.Errorf("POST not retried; calls=%d", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	p := fastRetry()
+	p.MaxDelay = 2 * time.Second
+	start := time.Now()
+	if err := ws.NewCaller(http.MethodGet, srv.URL).Retry(p).Call(srv.Client(), nil, nil); err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	if time.Since(start) < time.Second {
+		t.Errorf("Retry-After not respected; waited=%v", time.Since(start))
+	}
+}
+
+func TestCallDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := ws.NewCaller(http.MethodGet, srv.URL).CallContext(ctx, srv.Client(), nil, nil)
+	if ws.GetErrCode(err) != http.StatusGatewayTimeout {
+		t.Errorf("unexpected code for deadline; got=%d; err=%v", ws.GetErrCode(err), err)
+	}
+}
+
+func TestCallCanceled(t *testing.T) {
+	var calls int32
+	srv := failingServer(10, http.StatusServiceUnavailable, &calls)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := fastRetry()
+	p.BaseDelay = time.Second
+	p.MaxDelay = time.Second
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err := ws.NewCaller(http.MethodGet, srv.URL).Retry(p).CallContext(ctx, srv.Client(), nil, nil)
+	if ws.GetErrCode(err) != ws.StatusClientClosedRequest {
+		t.Errorf("unexpected code for canceled; got=%d; err=%v", ws.GetErrCode(err), err)
+	}
+	if calls != 1 {
+		t.Errorf("unexpected calls after cancel; got=%d", calls)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var calls int32
+	srv := failingServer(2, http.StatusInternalServerError, &calls)
+	defer srv.Close()
+
+	settings := ws.DefaultBreakerSettings()
+	settings.MinRequests = 2
+	settings.CoolDown = 100 * time.Millisecond
+	breakers := ws.NewBreakers(settings)
+	call := func() error {
+		return ws.NewCaller(http.MethodGet, srv.URL).Breaker(breakers).Call(srv.Client(), nil, nil)
+	}
+
+	call()
+	call()
+	err := call()
+	if !ws.IsBreakerOpen(err) || ws.GetErrCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("expected open breaker; err=%v", err)
+	}
+	if calls != 2 {
+		t.Errorf("call made through open breaker; calls=%d", calls)
+	}
+	status := breakers.Status()
+	if len(status) != 1 || status[0].State != "open" {
+		t.Errorf("unexpected breaker status; got=%+v", status)
+	}
+
+	time.Sleep(settings.CoolDown)
+	if err := call(); err != nil {
+		t.Fatalf("trial call failed; err=%v", err)
+	}
+	if state := breakers.Status()[0].State; state != "closed" {
+		t.Errorf("breaker not closed after trial; state=%s", state)
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ws.ContentProblemJSON)
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"type":"urn:mam:conflict","title":"Item locked","status":409,"detail":"item 1 is locked","lockedBy":"ingest"}`))
+	}))
+	defer srv.Close()
+
+	err := ws.NewCaller(http.MethodPut, srv.URL).JSON().Call(srv.Client(), &item{ID: "1"}, nil)
+	webErr, ok := errors.Cause(err).(*ws.WebError)
+	if !ok {
+		t.Fatalf("expected WebError; got=%v", err)
+	}
+	if webErr.Status != http.StatusConflict || webErr.Method != http.MethodPut {
+		t.Errorf("unexpected status/method; status=%d; method=%s", webErr.Status, webErr.Method)
+	}
+	if webErr.Header.Get("Content-Type") != ws.ContentProblemJSON || webErr.Body == "" {
+		t.Errorf("reply header/body missing; err=%v", webErr)
+	}
+	p := webErr.Problem
+	if p == nil || p.Title != "Item locked" || p.Status != 409 || p.Extensions["lockedBy"] != "ingest" {
+		t.Errorf("problem not parsed; got=%+v", p)
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	var gotCookie string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotCookie = r.Header.Get("Set-Cookie")
+		if len(r.Header["X-Tag"]) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := ws.NewCaller(http.MethodGet, srv.URL).AddHeader("X-Tag", "one").AddHeader("X-Tag", "two")
+	for i := 0; i < 2; i++ {
+		resp, err := c.Do(context.Background(), srv.Client(), nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error; err=%v", err)
+		}
+		if cookies := resp.HeaderValues("set-cookie"); len(cookies) != 2 {
+			t.Errorf("expected two cookies; got=%v", cookies)
+		}
+	}
+	if gotCookie != "" {
+		t.Errorf("reply header sent in request; got=%s", gotCookie)
+	}
+	if _, found := c.GetHeader("Set-Cookie"); found {
+		t.Errorf("reply header stored in caller")
+	}
+}
+
+func TestStreamBody(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("X-Length", strconv.FormatInt(r.ContentLength, 10))
+		w.Header().Set("X-Chunked", strconv.FormatBool(len(r.TransferEncoding) > 0))
+		w.Write(buf)
+	}))
+	defer srv.Close()
+
+	// seekable input is resent on retry
+	payload := strings.Repeat("manifest;", 1000)
+	var out bytes.Buffer
+	resp, err := ws.NewCaller(http.MethodPut, srv.URL).Retry(fastRetry()).Do(context.Background(), srv.Client(), strings.NewReader(payload), &out)
+	if err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	if out.String() != payload || resp.Header.Get("X-Length") != strconv.Itoa(len(payload)) {
+		t.Errorf("unexpected reply; len=%d; length=%s", out.Len(), resp.Header.Get("X-Length"))
+	}
+
+	// unknown length is sent chunked and read back as a stream
+	atomic.StoreInt32(&calls, 1)
+	in := ioutil.NopCloser(strings.NewReader(payload))
+	resp, err = ws.NewCaller(http.MethodPut, srv.URL).Stream(context.Background(), srv.Client(), in)
+	if err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	defer resp.Body.Close()
+	buf, _ := ioutil.ReadAll(resp.Body)
+	if string(buf) != payload || resp.Header.Get("X-Chunked") != "true" {
+		t.Errorf("unexpected stream reply; len=%d; chunked=%s", len(buf), resp.Header.Get("X-Chunked"))
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vendor":
+			// reply type differs from accept
+			w.Header().Set("Content-Type", "application/vnd.mam.item+json; charset=utf-8")
+			w.Write([]byte(`{"id":"7","name":"seven"}`))
+		case "/ndjson":
+			w.Header().Set("Content-Type", ws.ContentNDJSON)
+			io.Copy(w, r.Body)
+		case "/form":
+			r.ParseForm()
+			w.Header().Set("Content-Type", ws.ContentPlain)
+			w.Write([]byte(r.PostForm.Get("name")))
+		}
+	}))
+	defer srv.Close()
+
+	var out item
+	if err := ws.NewCaller(http.MethodGet, srv.URL+"/vendor").XML().Call(srv.Client(), nil, &out); err != nil || out.ID != "7" {
+		t.Errorf("vendor json not decoded; out=%+v; err=%v", out, err)
+	}
+
+	in := []item{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+	var list []item
+	if err := ws.NewCaller(http.MethodPost, srv.URL+"/ndjson").Content(ws.ContentNDJSON).Call(srv.Client(), in, &list); err != nil || len(list) != 3 || list[2].ID != "3" {
+		t.Errorf("ndjson round trip failed; list=%+v; err=%v", list, err)
+	}
+
+	var name string
+	form := url.Values{"name": {"form-name"}}
+	if err := ws.NewCaller(http.MethodPost, srv.URL+"/form").Content(ws.ContentForm).Call(srv.Client(), form, &name); err != nil || name != "form-name" {
+		t.Errorf("form not encoded; name=%s; err=%v", name, err)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	var tokens int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if id != "client" || secret != "secret" || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&tokens, 1)
+		ws.ReplyJSON(w, map[string]interface{}{"access_token": "token" + strconv.Itoa(int(n)), "token_type": "Bearer", "expires_in": 3600})
+	}))
+	defer tokenSrv.Close()
+
+	// first token is revoked by api
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	auth := ws.NewClientCredentials(tokenSrv.URL, "client", "secret", "items:read")
+	c := ws.NewCaller(http.MethodGet, srv.URL).Authenticator(auth)
+	for i := 0; i < 2; i++ {
+		if err := c.Call(srv.Client(), nil, nil); err != nil {
+			t.Fatalf("unexpected error; err=%v", err)
+		}
+	}
+	if tokens != 2 {
+		t.Errorf("unexpected number of tokens fetched; got=%d", tokens)
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	if err := ws.NewCaller(http.MethodGet, srv.URL).Authenticator(ws.APIKey{Header: "X-Api-Key", Key: "key"}).Call(srv.Client(), nil, nil); err != nil {
+		t.Errorf("unexpected error; err=%v", err)
+	}
+	err := ws.NewCaller(http.MethodGet, srv.URL).Authenticator(ws.BearerToken("bad")).Call(srv.Client(), nil, nil)
+	if ws.GetErrCode(err) != http.StatusUnauthorized {
+		t.Errorf("expected 401; err=%v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var gotID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get(ws.RequestIDHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var order []string
+	trace := func(name string) ws.Middleware {
+		return func(next ws.RoundTripFunc) ws.RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next(req)
+			}
+		}
+	}
+	ws.UseDefault(trace("default"))
+	defer ws.ResetDefault()
+
+	var logBuf bytes.Buffer
+	ctx := ws.WithRequestID(context.Background(), "req-1")
+	err := ws.NewCaller(http.MethodGet, srv.URL).
+		Auth("user", "secret-pwd").
+		Use(trace("caller"), ws.RequestIDMiddleware(), ws.LogMiddleware(zerolog.New(&logBuf))).
+		CallContext(ctx, srv.Client(), nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	if strings.Join(order, ",") != "default,caller" {
+		t.Errorf("unexpected middleware order; got=%v", order)
+	}
+	if gotID != "req-1" {
+		t.Errorf("request id not propagated; got=%s", gotID)
+	}
+	if !strings.Contains(logBuf.String(), `"status":204`) || !strings.Contains(logBuf.String(), `"Authorization":"***"`) {
+		t.Errorf("unexpected log; got=%s", logBuf.String())
+	}
+}
+
+func TestLogRedactsAPIKey(t *testing.T) {
+	var calls int32
+	srv := failingServer(0, 0, &calls)
+	defer srv.Close()
+
+	var logBuf bytes.Buffer
+	err := ws.NewCaller(http.MethodGet, srv.URL).
+		Authenticator(ws.APIKey{Header: "X-Mam-Key", Key: "secret-key"}).
+		Use(ws.LogMiddleware(zerolog.New(&logBuf))).
+		Call(srv.Client(), nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	if strings.Contains(logBuf.String(), "secret-key") || !strings.Contains(logBuf.String(), `"X-Mam-Key":"***"`) {
+		t.Errorf("api key not redacted; got=%s", logBuf.String())
+	}
+}
+
+func TestLogRedactsURL(t *testing.T) {
+	var calls int32
+	srv := failingServer(0, 0, &calls)
+	defer srv.Close()
+
+	var logBuf bytes.Buffer
+	u := strings.Replace(srv.URL, "http://", "http://svc:hunter2@", 1) + "/x?access_token=abc&q=items"
+	if err := ws.NewCaller(http.MethodGet, u).Use(ws.LogMiddleware(zerolog.New(&logBuf))).Call(srv.Client(), nil, nil); err != nil {
+		t.Fatalf("unexpected error; err=%v", err)
+	}
+	log := logBuf.String()
+	if strings.Contains(log, "hunter2") || strings.Contains(log, "abc") || !strings.Contains(log, "access_token=***&q=items") {
+		t.Errorf("url not redacted; got=%s", log)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var calls int32
+	srv := failingServer(1, http.StatusServiceUnavailable, &calls)
+	defer srv.Close()
+
+	ws.NewCaller(http.MethodGet, srv.URL).Retry(fastRetry()).Call(srv.Client(), nil, nil)
+
+	rec := httptest.NewRecorder()
+	ws.DefaultMetrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	host := strings.TrimPrefix(srv.URL, "http://")
+	for _, exp := range []string{
+		`ws_client_requests_total{host="` + host + `",method="GET",code="503"} 1`,
+		`ws_client_requests_total{host="` + host + `",method="GET",code="200"} 1`,
+		`ws_client_request_duration_seconds_count{host="` + host + `",method="GET",code="200"} 1`,
+		`# TYPE ws_client_request_duration_seconds histogram`,
+	} {
+		if !strings.Contains(rec.Body.String(), exp) {
+			t.Errorf("metric missing; exp=%s", exp)
+		}
+	}
+}
+
+type staticDiscovery map[string][]string
+
+func (d staticDiscovery) Instances(service string) ([]string, error) {
+	return d[service], nil
+}
+
+func TestDiscoveryFailover(t *testing.T) {
+	var calls int32
+	srv := failingServer(0, 0, &calls)
+	defer srv.Close()
+
+	// listener closed at once gives connection refused
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadAddr := strings.TrimPrefix(dead.URL, "http://")
+	dead.Close()
+
+	live := strings.TrimPrefix(srv.URL, "http://")
+	discovery := staticDiscovery{"mam-search": {deadAddr, live}}
+	balancer := ws.NewLeastRecentlyFailed()
+	for i := 0; i < 2; i++ {
+		var out item
+		err := ws.NewCaller(http.MethodGet, "consul://mam-search/v1/items").JSON().Discovery(discovery).Balancer(balancer).Call(srv.Client(), nil, &out)
+		if err != nil || out.ID != "1" {
+			t.Fatalf("failover failed; out=%+v; err=%v", out, err)
+		}
+	}
+	if order := balancer.Order("mam-search", discovery["mam-search"]); order[0] != live {
+		t.Errorf("failed instance not moved last; order=%v", order)
+	}
+}
+
+func TestDiscoveryNoFailoverAfterSend(t *testing.T) {
+	var hits int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer fast.Close()
+
+	// client timeout after the request was sent must not deliver the POST again
+	discovery := staticDiscovery{"mam-orders": {strings.TrimPrefix(slow.URL, "http://"), strings.TrimPrefix(fast.URL, "http://")}}
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	err := ws.NewCaller(http.MethodPost, "consul://mam-orders/v1/orders").JSON().Discovery(discovery).Balancer(ws.NewLeastRecentlyFailed()).Call(client, &item{ID: "1"}, nil)
+	if err == nil {
+		t.Errorf("expected timeout error")
+	}
+	if hits := atomic.LoadInt32(&hits); hits != 1 {
+		t.Errorf("POST failed over after send; hits=%d", hits)
+	}
+}
+
+func TestConsulDiscovery(t *testing.T) {
+	var calls int32
+	srv := failingServer(0, 0, &calls)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/mam-search" || r.URL.Query().Get("passing") == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `[{"Node":{"Node":"n1","Address":"%s"},"Service":{"ID":"search1","Service":"mam-search","Port":%s}}]`, host, port)
+	}))
+	defer consul.Close()
+
+	var out item
+	err := ws.NewCaller(http.MethodGet, "consul://mam-search/v1/items?q=x").JSON().
+		Discovery(ws.NewConsulDiscovery(consul.Client(), consul.URL)).
+		Call(srv.Client(), nil, &out)
+	if err != nil || out.ID != "1" {
+		t.Errorf("consul url not resolved; out=%+v; err=%v", out, err)
+	}
+}
@@ -2,12 +2,13 @@ package ws
 
 import (
 	"bytes"
-	"encoding/json"
-	"encoding/xml"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -18,14 +19,22 @@ const (
 	ContentPlain = "text/plain"
 )
 
+// StatusClientClosedRequest Code used in WebError when a call is canceled. Borrowed from nginx.
+const StatusClientClosedRequest = 499
+
 type Caller struct {
 	Method      string
 	URL         string
 	contentType string
 	accept      string
-	user        string
-	pwd         string
-	headers     map[string]string
+	auth        Authenticator
+	headers     http.Header // request headers
+	retry       *RetryPolicy
+	breakers    *Breakers
+	codecs      *Codecs
+	middleware  []Middleware
+	discovery   Discovery
+	balancer    Balancer
 	//outHeaders []keyValue
 	//webErr      *WebError
 }
@@ -44,21 +53,29 @@ func NewCaller(method, url string) *Caller {
 	return &Caller{
 		Method:  method,
 		URL:     url,
-		headers: make(map[string]string),
+		headers: make(http.Header),
 	}
 }
 
+// SetHeader Set a request header, replacing any previous values.
 func (c *Caller) SetHeader(name, value string) *Caller {
-	//c.headers = append(c.headers, keyValue{key: name, value: value})
-	c.headers[name] = value
+	c.headers.Set(name, value)
+	return c
+}
+
+// AddHeader Add a value to a request header.
+func (c *Caller) AddHeader(name, value string) *Caller {
+	c.headers.Add(name, value)
 	return c
 }
 
+// GetHeader Returns first value of a request header. Reply headers are found in Response.
 func (c *Caller) GetHeader(name string) (string, bool) {
-	// c.headers = append(c.headers, keyValue{key: name, value: value})
-	v, found := c.headers[name]
-	return v, found
-	//return "", c.headers[name]
+	v, found := c.headers[http.CanonicalHeaderKey(name)]
+	if !found || len(v) == 0 {
+		return "", false
+	}
+	return v[0], true
 }
 
 func (c *Caller) Accept(t string) *Caller {
@@ -88,73 +105,305 @@ func (c *Caller) Plain() *Caller {
 	return c
 }
 
+// Auth Use basic auth.
 func (c *Caller) Auth(user, pwd string) *Caller {
-	c.user = user
-	c.pwd = pwd
+	c.auth = BasicAuth{User: user, Password: pwd}
 	return c
 }
 
-func (c *Caller) getInBuffer(in interface{}) (*bytes.Buffer, error) {
-	buf := new(bytes.Buffer)
+// Authenticator Use a to add credentials to requests, e.g. BearerToken or ClientCredentials.
+func (c *Caller) Authenticator(a Authenticator) *Caller {
+	c.auth = a
+	return c
+}
+
+// Retry Set policy for retrying failed calls. A nil policy makes a single attempt.
+func (c *Caller) Retry(p *RetryPolicy) *Caller {
+	c.retry = p
+	return c
+}
+
+// Breaker Use circuit breakers from b, one per host. Calls fail fast with code 503 while a breaker is open.
+func (c *Caller) Breaker(b *Breakers) *Caller {
+	c.breakers = b
+	return c
+}
+
+// Codecs Use codecs from r to encode input and decode replies. Default is DefaultCodecs.
+func (c *Caller) Codecs(r *Codecs) *Caller {
+	c.codecs = r
+	return c
+}
+
+// Use Add middleware that runs for calls made by this Caller, after the default chain.
+func (c *Caller) Use(m ...Middleware) *Caller {
+	c.middleware = append(c.middleware, m...)
+	return c
+}
+
+// Discovery Use d to resolve service urls like consul://mam-search/v1/items. Default is DefaultDiscovery.
+func (c *Caller) Discovery(d Discovery) *Caller {
+	c.discovery = d
+	return c
+}
+
+// Balancer Use b to pick among instances of a service. Default is DefaultBalancer.
+func (c *Caller) Balancer(b Balancer) *Caller {
+	c.balancer = b
+	return c
+}
+
+func (c *Caller) getCodecs() *Codecs {
+	if c.codecs == nil {
+		return DefaultCodecs
+	}
+	return c.codecs
+}
+
+// getInBody Returns body for in. An io.Reader is streamed, other values are encoded
+// by the codec for the content type.
+func (c *Caller) getInBody(in interface{}) (*requestBody, error) {
 	if in == nil {
-		return buf, nil
+		return &requestBody{}, nil
 	}
-	if c.contentType == ContentJSON {
-		if err := json.NewEncoder(buf).Encode(in); err != nil {
-			return nil, errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed encode json")
-		}
-	} else if c.contentType == ContentXML {
-		if err := xml.NewEncoder(buf).Encode(in); err != nil {
-			return nil, errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed encode xml")
-		}
+	if r, ok := in.(io.Reader); ok {
+		body := newStreamBody(r)
+		body.contentType = c.contentType
+		return body, nil
+	}
+	if c.contentType == "" {
+		return nil, errors.Wrapf(NewWebError(errors.New("content type missing"), c.URL, http.StatusInternalServerError), "failed encode request")
+	}
+	codec, isFound := c.getCodecs().Lookup(c.contentType)
+	if !isFound {
+		return nil, errors.Wrapf(NewWebError(errors.Errorf("no codec for content type; %s", c.contentType), c.URL, http.StatusInternalServerError), "failed encode request")
+	}
+	buf := new(bytes.Buffer)
+	contentType, err := codec.Encode(buf, in, c.contentType)
+	if err != nil {
+		return nil, errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed encode request; %s", c.contentType)
 	}
-	return buf, nil
+	return &requestBody{buf: buf.Bytes(), contentType: contentType}, nil
 }
 
+// Call Same as CallContext, without a deadline.
 func (c *Caller) Call(client *http.Client, in interface{}, out interface{}) error {
-	buf, webErr := c.getInBuffer(in)
+	return c.CallContext(context.Background(), client, in, out)
+}
+
+// CallContext Same as Do, but only returns the error.
+func (c *Caller) CallContext(ctx context.Context, client *http.Client, in interface{}, out interface{}) error {
+	_, err := c.Do(ctx, client, in, out)
+	return err
+}
+
+// Do Call url with in as body and decode reply into out. Returns status and headers of the reply.
+// Response is also returned with error replies, but is nil if no reply was received.
+// If in is an io.Reader it is streamed as body. If out is an io.Writer the reply body is copied to it.
+// The call is aborted when ctx is done. An expired deadline gives a WebError with
+// code 504 and a canceled ctx gives code StatusClientClosedRequest.
+// The Caller is not modified by the call and can be reused.
+func (c *Caller) Do(ctx context.Context, client *http.Client, in interface{}, out interface{}) (*Response, error) {
+	resp, attempts, err := c.roundTrip(ctx, client, in, out != nil)
+	if err != nil {
+		return nil, err
+	}
+	reply := newResponse(resp, attempts)
+	err = c.readResponse(resp, out)
+	if err != nil && ctx.Err() != nil {
+		err = c.contextError(ctx.Err()) // body read aborted
+	}
+	return reply, c.withCallInfo(err, attempts)
+}
+
+// Stream Call url with in as body and return the reply without reading it.
+// Response.Body must be closed by the caller. Error replies are returned as WebError
+// with the body already read and closed.
+func (c *Caller) Stream(ctx context.Context, client *http.Client, in interface{}) (*Response, error) {
+	resp, attempts, err := c.roundTrip(ctx, client, in, true)
+	if err != nil {
+		return nil, err
+	}
+	reply := newResponse(resp, attempts)
+	if !isSuccess(resp.StatusCode) {
+		return reply, c.withCallInfo(c.errorReply(resp), attempts)
+	}
+	reply.Body = resp.Body
+	return reply, nil
+}
+
+// roundTrip Send request, with retries, and return the reply with unread body.
+func (c *Caller) roundTrip(ctx context.Context, client *http.Client, in interface{}, accept bool) (*http.Response, int, error) {
+	body, webErr := c.getInBody(in)
 	if webErr != nil {
-		return webErr
+		return nil, 0, webErr
+	}
+
+	refreshed := 0 // extra call made after renewing credentials
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, client, accept, body)
+		if refreshed == 0 && ctx.Err() == nil && body.canRepeat() && c.shouldRefreshAuth(resp, err) {
+			DiscardBody(resp)
+			refreshed = 1
+			continue
+		}
+		if ctx.Err() == nil && body.canRepeat() && c.retry.shouldRetry(c.Method, attempt-refreshed, resp, err) {
+			wait := c.retry.delay(attempt-refreshed, resp)
+			DiscardBody(resp)
+			if err := sleep(ctx, wait); err != nil {
+				return nil, attempt, c.withCallInfo(c.contextError(err), attempt)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, attempt, c.withCallInfo(err, attempt)
+		}
+		return resp, attempt, nil
+	}
+}
+
+// send Makes a single attempt to call the url. Service urls are resolved through
+// discovery and fail over to the next instance on connection errors, see isFailoverError.
+func (c *Caller) send(ctx context.Context, client *http.Client, accept bool, body *requestBody) (*http.Response, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed to parse url")
+	}
+	if !isDiscoveryURL(u) {
+		return c.sendTo(ctx, client, accept, body, c.URL)
 	}
 
-	req, err := http.NewRequest(c.Method, c.URL, buf)
+	discovery := c.discovery
+	if discovery == nil {
+		discovery = DefaultDiscovery
+	}
+	if discovery == nil {
+		return nil, errors.Wrapf(NewWebError(errors.New("no discovery for service url"), c.URL, http.StatusInternalServerError), "failed to resolve url")
+	}
+	service := u.Host
+	instances, err := discovery.Instances(service)
+	if err == nil && len(instances) == 0 {
+		err = errors.Errorf("no instances of service; service=%s", service)
+	}
 	if err != nil {
-		return errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed to create request")
-		//return NewWebError(errors.Wrap(err, "failed to create request"), c.URL, http.StatusInternalServerError)
+		return nil, errors.Wrapf(NewWebError(err, c.URL, http.StatusServiceUnavailable), "failed to resolve url")
 	}
-	if in != nil && c.contentType != "" {
-		req.Header.Set("Content-Type", c.contentType)
+
+	balancer := c.balancer
+	if balancer == nil {
+		balancer = DefaultBalancer
 	}
-	if out != nil && c.accept != "" {
+	repeatable := isIdempotent(c.Method) || (c.retry != nil && c.retry.AllMethods)
+	for i, instance := range balancer.Order(service, instances) {
+		if i > 0 && !body.canRepeat() {
+			break
+		}
+		var resp *http.Response
+		resp, err = c.sendTo(ctx, client, accept, body, instanceURL(u, instance))
+		if err == nil {
+			balancer.Report(service, instance, false)
+			return resp, nil
+		}
+		if ctx.Err() != nil || !isFailoverError(err, repeatable) {
+			return nil, err
+		}
+		balancer.Report(service, instance, true)
+	}
+	return nil, err
+}
+
+// sendTo Makes a single call to rawURL.
+func (c *Caller) sendTo(ctx context.Context, client *http.Client, accept bool, body *requestBody, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(c.Method, rawURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(NewWebError(err, rawURL, http.StatusInternalServerError), "failed to create request")
+	}
+
+	breaker := c.breakers.Get(req.URL.Host)
+	if !breaker.Allow() {
+		return nil, errors.Wrapf(NewWebError(ErrBreakerOpen, rawURL, http.StatusServiceUnavailable), "failed to call url")
+	}
+
+	reader, length, err := body.open()
+	if err != nil {
+		breaker.release()
+		return nil, errors.Wrapf(NewWebError(err, rawURL, http.StatusInternalServerError), "failed to rewind request body")
+	}
+	setBody(req, reader, length)
+	req = req.WithContext(ctx)
+	if body.contentType != "" {
+		req.Header.Set("Content-Type", body.contentType)
+	}
+	if accept && c.accept != "" {
 		req.Header.Set("Accept", c.accept)
 	}
-	if c.user != "" || c.pwd != "" {
-		req.SetBasicAuth(c.user, c.pwd)
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req); err != nil {
+			breaker.release()
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, c.contextError(ctxErr)
+			}
+			return nil, errors.Wrapf(NewWebError(err, rawURL, http.StatusBadGateway), "failed to authenticate")
+		}
 	}
 	for k, v := range c.headers {
-		fmt.Printf("add header: %s=%s\n", k, v)
-		req.Header.Set(k, v)
+		req.Header[k] = append([]string(nil), v...)
 	}
 
-	resp, err := client.Do(req)
+	resp, err := chain(client.Do, getDefaultChain(), c.middleware, []Middleware{DefaultMetrics.Middleware()})(req)
+	if ctx.Err() == nil {
+		breaker.Record(!isBreakerFailure(resp, err))
+	} else {
+		breaker.release() // aborted by caller, says nothing about the host
+	}
 	if err != nil {
-		return errors.Wrapf(NewWebError(err, c.URL, http.StatusBadGateway), "failed to call url")
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, c.contextError(ctxErr)
+		}
+		return nil, errors.Wrapf(NewWebError(err, rawURL, http.StatusBadGateway), "failed to call url")
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
-	// save out headers
-	for k, v := range resp.Header {
-		if len(v) != 1 {
-			continue // todo: currently only handles single value headers
-		}
-		c.headers[k] = v[0]
-		//c.headers = append(c.headers, keyValue{key: k, value: v[0]})
+// shouldRefreshAuth Returns true if reply is 401 and credentials were invalidated so a new call can be made.
+func (c *Caller) shouldRefreshAuth(resp *http.Response, err error) bool {
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return false
 	}
+	inv, ok := c.auth.(Invalidator)
+	if !ok {
+		return false
+	}
+	inv.Invalidate()
+	return true
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		DiscardBody(resp)
-		// todo: log reply body
-		return errors.Wrapf(NewWebError(fmt.Errorf("http error code reply; code=%d", resp.StatusCode), c.URL, resp.StatusCode), "")
+// contextError Map error from a done context to a WebError.
+func (c *Caller) contextError(err error) error {
+	if err == context.DeadlineExceeded {
+		return errors.Wrapf(NewWebError(err, c.URL, http.StatusGatewayTimeout), "call deadline exceeded")
+	}
+	return errors.Wrapf(NewWebError(err, c.URL, StatusClientClosedRequest), "call canceled")
+}
+
+// sleep Wait for d or until ctx is done, in which case the ctx error is returned.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readResponse Check status code and decode body of resp into out.
+func (c *Caller) readResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+
+	if !isSuccess(resp.StatusCode) {
+		return c.errorReply(resp)
 	}
 
 	if out == nil {
@@ -162,26 +411,55 @@ func (c *Caller) Call(client *http.Client, in interface{}, out interface{}) erro
 		return nil
 	}
 
-	if c.accept == ContentXML {
-		if err := xml.NewDecoder(resp.Body).Decode(out); err != nil {
-			return errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed decode response")
-		}
-	} else if c.accept == ContentJSON {
-		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
-			return errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed decode response")
-		}
-	} else if c.accept == ContentPlain {
-		if v, ok := out.(*string); ok {
-			buf, err := ioutil.ReadAll(resp.Body)
-			if err != nil {
-				return errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed read text/plain response")
-			}
-			*v = string(buf)
+	if w, ok := out.(io.Writer); ok {
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			return errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed copy response")
 		}
+		return nil
+	}
+
+	// Pick codec from actual reply type. Fall back to what we asked for.
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = c.accept
+	}
+	codec, isFound := c.getCodecs().Lookup(contentType)
+	if !isFound {
+		DiscardBody(resp)
+		return errors.Wrapf(NewWebError(errors.Errorf("no codec for content type; %s", contentType), c.URL, http.StatusInternalServerError), "failed decode response")
+	}
+	if err := codec.Decode(resp.Body, out, contentType); err != nil {
+		return errors.Wrapf(NewWebError(err, c.URL, http.StatusInternalServerError), "failed decode response; %s", contentType)
 	}
 	return nil
 }
 
+// errorReply Returns WebError for a reply with error status. Reads and closes the body.
+func (c *Caller) errorReply(resp *http.Response) error {
+	webErr := &WebError{
+		Cause:  fmt.Errorf("http error code reply; code=%d", resp.StatusCode),
+		URL:    c.URL,
+		Code:   resp.StatusCode,
+		Status: resp.StatusCode,
+		Header: resp.Header,
+	}
+	webErr.Body, webErr.Problem = readErrorBody(resp)
+	return errors.Wrapf(webErr, "")
+}
+
+func isSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// withCallInfo Record method and number of attempts made in the WebError of err.
+func (c *Caller) withCallInfo(err error, attempts int) error {
+	if webErr, ok := errors.Cause(err).(*WebError); ok {
+		webErr.Attempts = attempts
+		webErr.Method = c.Method
+	}
+	return err
+}
+
 func DiscardBody(resp *http.Response) {
 	if resp == nil || resp.Body == nil {
 		return
@@ -3,6 +3,8 @@ package ws
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/pkg/errors"
 )
 
 type WebError struct {
@@ -10,6 +12,14 @@ type WebError struct {
 	Msg   string
 	URL   string
 	Code  int
+	// Attempts is the number of calls made before giving up. Zero if not from a Caller.
+	Attempts int
+	Method   string
+	// Fields below are only set when a reply was received.
+	Status  int         // status code of the reply
+	Header  http.Header // headers of the reply
+	Body    string      // start of reply body, see MaxErrorBody
+	Problem *Problem    // parsed body if reply was application/problem+json
 }
 
 func NewWebErrorMsg(cause error, msg string, code int) error {
@@ -21,7 +31,14 @@ func NewWebError(cause error, url string, code int) error {
 }
 
 func (e *WebError) Error() string {
-	return fmt.Sprintf("error calling url; code=%d; msg=%s; url=%s; cause=%v", e.Code, e.Msg, e.URL, e.Cause)
+	s := fmt.Sprintf("error calling url; code=%d; msg=%s; method=%s; url=%s; attempts=%d; cause=%v", e.Code, e.Msg, e.Method, e.URL, e.Attempts, e.Cause)
+	if e.Problem != nil {
+		return fmt.Sprintf("%s; title=%s; detail=%s", s, e.Problem.Title, e.Problem.Detail)
+	}
+	if e.Body != "" {
+		return fmt.Sprintf("%s; body=%s", s, e.Body)
+	}
+	return s
 }
 
 func (e *WebError) GetErrCode() int {
@@ -38,7 +55,7 @@ func GetErrCode(err error) int {
 		return 0
 	}
 
-	if ec, ok := err.(errcode); ok {
+	if ec, ok := errors.Cause(err).(errcode); ok {
 		return ec.GetErrCode()
 	}
 	return http.StatusInternalServerError // unknown error